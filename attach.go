@@ -0,0 +1,90 @@
+package litebeam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// AttachDialect is the SQL dialect AttachSQL writes.
+type AttachDialect int
+
+const (
+	// AttachSQLite writes URI filenames for SQLite, such as the sqlite3
+	// CLI. SQLite attaches at most 10 databases unless built with a higher
+	// SQLITE_MAX_ATTACHED, up to 125.
+	AttachSQLite AttachDialect = iota
+	// AttachDuckDB writes ATTACH statements for DuckDB's sqlite extension.
+	AttachDuckDB
+)
+
+// AttachOptions controls AttachSQL.
+type AttachOptions struct {
+	Dialect AttachDialect
+	// Tables lists the tables to create UNION ALL views for. Defaults to
+	// every table of shard 1 except litebeam's own.
+	Tables []string
+	// Immutable attaches SQLite shards with immutable=1, which skips
+	// locking and ignores the WAL. Only set it for files that nothing is
+	// writing to and whose WAL has been checkpointed.
+	Immutable bool
+}
+
+// ShardFiles returns the path of every shard's file, keyed by shard ID.
+func (l *Litebeam) ShardFiles() map[int]string {
+	files := make(map[int]string, l.Config.TotalShards)
+	for _, id := range l.shardIDs() {
+		files[id] = l.Config.shardPath(id)
+	}
+	return files
+}
+
+// AttachSQL returns a script that attaches every shard read-only, as
+// schema shard_<id>, and creates a temporary view for each table that
+// unions it across all shards with a leading shard_id column, so external
+// engines can query the whole dataset. Encrypted shards cannot be
+// attached by other engines, so it fails when KeyProvider is set.
+func (l *Litebeam) AttachSQL(ctx context.Context, opts AttachOptions) (string, error) {
+	if l.Config.KeyProvider != nil {
+		return "", errors.New("encrypted shards cannot be attached by other engines")
+	}
+	tables := opts.Tables
+	if tables == nil {
+		var err error
+		if tables, err = l.userTables(ctx, 1); err != nil {
+			return "", fmt.Errorf("error listing tables: %v", err)
+		}
+	}
+
+	var b strings.Builder
+	for _, id := range l.shardIDs() {
+		path := l.Config.shardPath(id)
+		switch opts.Dialect {
+		case AttachSQLite:
+			params := url.Values{"mode": {"ro"}}
+			if opts.Immutable {
+				params.Set("immutable", "1")
+			}
+			fmt.Fprintf(&b, "ATTACH DATABASE %s AS shard_%d;\n", quoteLiteral(fileURI(path, params)), id)
+		case AttachDuckDB:
+			fmt.Fprintf(&b, "ATTACH %s AS shard_%d (TYPE sqlite, READ_ONLY);\n", quoteLiteral(path), id)
+		default:
+			return "", fmt.Errorf("unknown attach dialect %d", opts.Dialect)
+		}
+	}
+	for _, table := range tables {
+		t := quoteIdent(table)
+		selects := make([]string, 0, l.Config.TotalShards)
+		for _, id := range l.shardIDs() {
+			selects = append(selects, fmt.Sprintf("SELECT %d AS shard_id, * FROM shard_%d.%s", id, id, t))
+		}
+		fmt.Fprintf(&b, "CREATE TEMP VIEW %s AS\n  %s;\n", t, strings.Join(selects, "\n  UNION ALL "))
+	}
+	return b.String(), nil
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
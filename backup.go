@@ -0,0 +1,362 @@
+package litebeam
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BackupShard writes a consistent copy of shard id to dst using VACUUM INTO.
+// It reads through a reader pool, so writes carry on while it runs; the copy
+// holds the shard as of the start of the backup. The copy is written under
+// a temporary name and renamed to dst, replacing any file already there.
+func (l *Litebeam) BackupShard(ctx context.Context, id int, dst string) error {
+	return l.withShard(id, func(s *Shard) error {
+		return backupDB(ctx, s, dst)
+	})
+}
+
+func backupDB(ctx context.Context, s *Shard, dst string) error {
+	return vacuumInto(ctx, s.NextReader(), s.key, dst)
+}
+
+// vacuumInto writes a copy of db, encrypted with key if set, to dst.
+func vacuumInto(ctx context.Context, db *sql.DB, key []byte, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("error creating backup directory: %v", err)
+	}
+	tmp := dst + ".tmp"
+	// VACUUM INTO refuses to overwrite an existing file.
+	if err := removeDBFiles(tmp); err != nil {
+		return err
+	}
+	defer removeDBFiles(tmp)
+
+	if _, err := db.ExecContext(ctx, "VACUUM INTO ?", sqlName(tmp, key)); err != nil {
+		return fmt.Errorf("error backing up shard: %v", err)
+	}
+	return os.Rename(tmp, dst)
+}
+
+// RestoreShard replaces shard id's file with the backup at src. The backup
+// is copied next to the shard under a temporary name and checked with
+// quick_check before it is renamed into place and the shard's old -wal and
+// -shm files are removed. The shard is closed while this runs, and
+// requests for it fail with ErrShardMoving; it cannot be restored while
+// leased. A shard too damaged to open can still be restored.
+func (l *Litebeam) RestoreShard(ctx context.Context, id int, src string) error {
+	if err := l.writable(); err != nil {
+		return err
+	}
+	key, err := shardKey(l.Config.KeyProvider, id)
+	if err != nil {
+		return err
+	}
+	if err := quickCheck(ctx, src, key); err != nil {
+		return fmt.Errorf("backup %s failed verification: %v", src, err)
+	}
+
+	done, err := l.detachShard(id, false)
+	if err != nil {
+		return err
+	}
+	err = copyShardFile(ctx, src, l.Config.shardPath(id), key)
+	done()
+	if err != nil {
+		return fmt.Errorf("error restoring shard %d: %v", id, err)
+	}
+	l.shardRestored(id, src)
+	return nil
+}
+
+// ManifestFile is the name of the manifest BackupAll writes into a backup
+// directory.
+const ManifestFile = "manifest.json"
+
+// BackupManifest describes a backup set written by BackupAll.
+type BackupManifest struct {
+	CreatedAt   time.Time     `json:"created_at"`
+	TotalShards int           `json:"total_shards"`
+	Shards      []ShardBackup `json:"shards"`
+}
+
+// ShardBackup describes one shard's file in a backup set.
+type ShardBackup struct {
+	ShardID int `json:"shard_id"`
+	// Path is the backup file, relative to the backup directory.
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Rows is the number of rows across the shard's tables.
+	Rows int64 `json:"rows"`
+	// Compression is "gzip" for files written through a GzipTarget. Size
+	// and SHA256 always describe the uncompressed file.
+	Compression string `json:"compression,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// BackupAll backs up every shard into dir and writes a manifest of the set
+// to dir/manifest.json. It is BackupAllTo with a DirTarget.
+func (l *Litebeam) BackupAll(ctx context.Context, dir string) (*BackupManifest, error) {
+	return l.BackupAllTo(ctx, DirTarget(dir))
+}
+
+// BackupAllTo backs up every shard to target, one shard at a time, and
+// writes a manifest of the set last, as manifest.json. Unless target is a
+// DirTarget, each shard is first staged in a temporary directory, so only
+// one shard's worth of local space is needed at a time. A failed shard is
+// recorded in the manifest with its error and does not stop the others;
+// the returned error joins every failure. Targets reporting a compression
+// other than "gzip" are refused.
+func (l *Litebeam) BackupAllTo(ctx context.Context, target BackupTarget) (*BackupManifest, error) {
+	compression := target.Compression()
+	if compression != "" && compression != "gzip" {
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+	stage, direct := target.(DirTarget)
+	if !direct {
+		dir, err := os.MkdirTemp("", "litebeam-backup-")
+		if err != nil {
+			return nil, fmt.Errorf("error creating staging directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		stage = DirTarget(dir)
+	}
+
+	manifest := &BackupManifest{
+		CreatedAt:   time.Now().UTC(),
+		TotalShards: l.Config.TotalShards,
+		Shards:      make([]ShardBackup, l.Config.TotalShards),
+	}
+	errs := l.fanOut(ctx, l.shardIDs(), 1, func(ctx context.Context, id int, s *Shard) error {
+		b := &manifest.Shards[id-1]
+		b.Path = fmt.Sprintf(dbFilePattern, id)
+		staged := filepath.Join(string(stage), b.Path)
+		if err := backupDB(ctx, s, staged); err != nil {
+			return err
+		}
+		if err := describeBackup(ctx, staged, s.key, b); err != nil {
+			return err
+		}
+		if direct {
+			return nil
+		}
+		defer os.Remove(staged)
+		if compression != "" {
+			b.Path += ".gz"
+			b.Compression = compression
+		}
+		return writeToTarget(ctx, target, staged, b.Path)
+	})
+
+	var failed []error
+	for i := range manifest.Shards {
+		b := &manifest.Shards[i]
+		b.ShardID = i + 1
+		if err := errs[b.ShardID]; err != nil {
+			b.Error = err.Error()
+			failed = append(failed, fmt.Errorf("failed to back up shard %d: %w", b.ShardID, err))
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	w, err := target.Create(ctx, ManifestFile, int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("error writing backup manifest: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("error writing backup manifest: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("error writing backup manifest: %v", err)
+	}
+	return manifest, errors.Join(failed...)
+}
+
+// RestoreAll restores every shard from the backup set described by the
+// manifest at manifestPath, checking each file against its recorded
+// SHA-256 before restoring it with RestoreShard. The shard files must sit
+// next to the manifest, so sets written to other targets are fetched or
+// unpacked first. The set must have been taken with the same TotalShards.
+// It carries on past failing shards and returns their errors joined.
+func (l *Litebeam) RestoreAll(ctx context.Context, manifestPath string) error {
+	if err := l.writable(); err != nil {
+		return err
+	}
+	manifest, err := ReadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	if manifest.TotalShards != l.Config.TotalShards {
+		return fmt.Errorf("backup has %d shards, configured for %d", manifest.TotalShards, l.Config.TotalShards)
+	}
+
+	dir := filepath.Dir(manifestPath)
+	var errs []error
+	for _, b := range manifest.Shards {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if b.Error != "" {
+			errs = append(errs, fmt.Errorf("shard %d has no backup: %s", b.ShardID, b.Error))
+			continue
+		}
+		if err := l.restoreFromSet(ctx, dir, b); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// restoreFromSet checks and restores one shard of the backup set in dir,
+// decompressing it first if needed.
+func (l *Litebeam) restoreFromSet(ctx context.Context, dir string, b ShardBackup) error {
+	path, cleanup, err := backupFile(dir, b)
+	if err != nil {
+		return fmt.Errorf("shard %d: %w", b.ShardID, err)
+	}
+	defer cleanup()
+	if err := checkBackupSum(path, b.SHA256); err != nil {
+		return fmt.Errorf("shard %d: %w", b.ShardID, err)
+	}
+	return l.RestoreShard(ctx, b.ShardID, path)
+}
+
+// backupFile returns the path of b's uncompressed file in dir, writing it
+// to a temporary file that cleanup removes if b is compressed.
+func backupFile(dir string, b ShardBackup) (path string, cleanup func(), err error) {
+	path = filepath.Join(dir, b.Path)
+	switch b.Compression {
+	case "":
+		return path, func() {}, nil
+	case "gzip":
+	default:
+		return "", nil, fmt.Errorf("unknown compression %q", b.Compression)
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer in.Close()
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return "", nil, err
+	}
+	out, err := os.CreateTemp("", "litebeam-restore-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.Remove(out.Name()) }
+	_, err = io.Copy(out, zr)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return out.Name(), cleanup, nil
+}
+
+// ReadManifest reads a manifest written by BackupAll.
+func ReadManifest(path string) (*BackupManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading backup manifest: %v", err)
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("error parsing backup manifest: %v", err)
+	}
+	return &manifest, nil
+}
+
+func checkBackupSum(path, want string) error {
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if sum != want {
+		return fmt.Errorf("checksum mismatch for %s", path)
+	}
+	return nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// describeBackup fills in the size, checksum and row count of the backup
+// file at path, encrypted with key if set.
+func describeBackup(ctx context.Context, path string, key []byte, b *ShardBackup) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	b.Size = info.Size()
+	if b.SHA256, err = fileSHA256(path); err != nil {
+		return err
+	}
+
+	db, err := openFile(path, key)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	b.Rows, err = countRows(ctx, db)
+	return err
+}
+
+// countRows returns the number of rows across every table in db.
+func countRows(ctx context.Context, db *sql.DB) (int64, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return 0, err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, table := range tables {
+		var n int64
+		if err := db.QueryRowContext(ctx, "SELECT count(*) FROM "+quoteIdent(table)).Scan(&n); err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,134 @@
+package litebeam
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// backupSetLayout names the directories of scheduled backup sets.
+const backupSetLayout = "20060102T150405Z"
+
+// BackupRetention decides which scheduled backup sets are kept. A set is
+// kept if any rule keeps it; the zero value keeps every set.
+type BackupRetention struct {
+	// KeepLast keeps the newest sets.
+	KeepLast int
+	// KeepDaily keeps the newest set of each of the last days that have a
+	// set.
+	KeepDaily int
+	// KeepWeekly keeps the newest set of each of the last ISO weeks that
+	// have a set.
+	KeepWeekly int
+}
+
+// The rules above only count complete sets: those whose manifest lists
+// no failed shard. Incomplete sets newer than the newest complete one are
+// kept too, up to KeepLast or at least one, so the latest copy of the
+// healthy shards survives a shard that keeps failing, such as one left
+// quarantined. Older incomplete sets are removed.
+
+func (r BackupRetention) keepAll() bool {
+	return r.KeepLast <= 0 && r.KeepDaily <= 0 && r.KeepWeekly <= 0
+}
+
+// backupScheduled writes a backup set into a new timestamped directory of
+// BackupDir and prunes old sets by BackupRetention.
+func (l *Litebeam) backupScheduled() {
+	ctx, cancel := l.taskContext()
+	defer cancel()
+
+	now := time.Now().UTC()
+	dir := filepath.Join(l.Config.BackupDir, now.Format(backupSetLayout))
+	manifest, err := l.BackupAll(ctx, dir)
+	if err != nil {
+		l.Config.logger().Error("scheduled backup failed", "dir", dir, "err", err)
+	}
+	// A set with failed shards still has a manifest and is pruned after
+	// like any other, so a failing shard does not stop retention.
+	if manifest == nil {
+		return
+	}
+	if err := pruneBackups(l.Config.BackupDir, l.Config.BackupRetention); err != nil {
+		l.Config.logger().Error("failed to prune backups", "err", err)
+	}
+}
+
+// backupSet is a scheduled backup set found in BackupDir.
+type backupSet struct {
+	time time.Time
+	// complete is true when the set's manifest lists no failed shard.
+	complete bool
+}
+
+// backupSets returns the scheduled backup sets in dir, newest first.
+func backupSets(dir string) ([]backupSet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var sets []backupSet
+	for _, e := range entries {
+		t, err := time.Parse(backupSetLayout, e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		manifest, err := ReadManifest(filepath.Join(dir, e.Name(), ManifestFile))
+		complete := err == nil && !slices.ContainsFunc(manifest.Shards, func(b ShardBackup) bool { return b.Error != "" })
+		sets = append(sets, backupSet{time: t, complete: complete})
+	}
+	slices.SortFunc(sets, func(a, b backupSet) int { return b.time.Compare(a.time) })
+	return sets, nil
+}
+
+// pruneBackups removes the backup sets in dir that retention does not keep.
+// Only directories named like scheduled sets are considered.
+func pruneBackups(dir string, retention BackupRetention) error {
+	if retention.keepAll() {
+		return nil
+	}
+	sets, err := backupSets(dir)
+	if err != nil {
+		return err
+	}
+
+	keep := map[time.Time]bool{}
+	days := map[string]bool{}
+	weeks := map[string]bool{}
+	complete, incomplete := 0, 0
+	for _, set := range sets {
+		t := set.time
+		if !set.complete {
+			// Only incomplete sets newer than every complete one are kept.
+			if complete == 0 && incomplete < max(retention.KeepLast, 1) {
+				keep[t] = true
+			}
+			incomplete++
+			continue
+		}
+		if complete < retention.KeepLast {
+			keep[t] = true
+		}
+		complete++
+		if day := t.Format(time.DateOnly); !days[day] && len(days) < retention.KeepDaily {
+			days[day] = true
+			keep[t] = true
+		}
+		year, week := t.ISOWeek()
+		if w := fmt.Sprintf("%d-%d", year, week); !weeks[w] && len(weeks) < retention.KeepWeekly {
+			weeks[w] = true
+			keep[t] = true
+		}
+	}
+
+	for _, set := range sets {
+		if !keep[set.time] {
+			if err := os.RemoveAll(filepath.Join(dir, set.time.Format(backupSetLayout))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package litebeam
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BackupTarget stores the files of a backup set, such as a local
+// directory, an archive stream or object storage. Files are written one at
+// a time.
+type BackupTarget interface {
+	// Create starts the file name, which will hold size bytes. The file is
+	// complete once the returned writer's Close returns nil.
+	Create(ctx context.Context, name string, size int64) (io.WriteCloser, error)
+	// Compression names the compression Create applies to shard files,
+	// as recorded in the manifest: "gzip", or "" for none. A target that
+	// passes files on to another target unchanged, such as one adding
+	// logging, returns the other target's; one that compresses them
+	// itself, like GzipTarget, returns its own. zstd is not supported,
+	// as it is not in the standard library.
+	Compression() string
+}
+
+// DirTarget writes a backup set into a local directory. Each file is
+// written under a temporary name and renamed once complete.
+type DirTarget string
+
+func (d DirTarget) Create(ctx context.Context, name string, size int64) (io.WriteCloser, error) {
+	path := filepath.Join(string(d), name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &dirFile{File: f, path: path}, nil
+}
+
+func (d DirTarget) Compression() string { return "" }
+
+type dirFile struct {
+	*os.File
+	path string
+}
+
+func (f *dirFile) Close() error {
+	if err := f.Sync(); err != nil {
+		f.File.Close()
+		return err
+	}
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), f.path)
+}
+
+// TarTarget writes a backup set as a tar stream, for example to a pipe or
+// an upload. Close must be called after the backup to finish the archive.
+type TarTarget struct {
+	tw *tar.Writer
+}
+
+// NewTarTarget returns a TarTarget writing to w.
+func NewTarTarget(w io.Writer) *TarTarget {
+	return &TarTarget{tw: tar.NewWriter(w)}
+}
+
+func (t *TarTarget) Create(ctx context.Context, name string, size int64) (io.WriteCloser, error) {
+	err := t.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Size:    size,
+		Mode:    0o644,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tarFile{t.tw}, nil
+}
+
+func (t *TarTarget) Compression() string { return "" }
+
+// Close finishes the archive. It does not close the underlying writer.
+func (t *TarTarget) Close() error {
+	return t.tw.Close()
+}
+
+type tarFile struct {
+	tw *tar.Writer
+}
+
+func (f tarFile) Write(p []byte) (int, error) { return f.tw.Write(p) }
+func (f tarFile) Close() error                { return f.tw.Flush() }
+
+// writeToTarget copies the local file at path to target as name.
+func writeToTarget(ctx context.Context, target BackupTarget, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	w, err := target.Create(ctx, name, info.Size())
+	if err != nil {
+		return fmt.Errorf("error creating %s on backup target: %v", name, err)
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		w.Close()
+		return fmt.Errorf("error writing %s to backup target: %v", name, err)
+	}
+	return w.Close()
+}
+
+// GzipTarget compresses every shard file with gzip before handing it to
+// Target under the same name; BackupAllTo names them with a .gz suffix.
+// The manifest is passed to Target uncompressed and records which files
+// are compressed, so RestoreAll can undo it. To compress a whole tar
+// archive instead, give NewTarTarget a gzip.Writer.
+type GzipTarget struct {
+	Target BackupTarget
+	// Level is a compress/gzip level; zero means gzip.DefaultCompression.
+	Level int
+}
+
+// Create compresses into a temporary file, as Target needs the compressed
+// size up front, and passes it on to Target on Close. The manifest is
+// passed straight to Target.
+func (g GzipTarget) Create(ctx context.Context, name string, size int64) (io.WriteCloser, error) {
+	if name == ManifestFile {
+		return g.Target.Create(ctx, name, size)
+	}
+	level := g.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	tmp, err := os.CreateTemp("", "litebeam-gzip-")
+	if err != nil {
+		return nil, err
+	}
+	zw, err := gzip.NewWriterLevel(tmp, level)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return &gzipFile{ctx: ctx, target: g.Target, name: name, tmp: tmp, zw: zw}, nil
+}
+
+func (g GzipTarget) Compression() string { return "gzip" }
+
+type gzipFile struct {
+	ctx    context.Context
+	target BackupTarget
+	name   string
+	tmp    *os.File
+	zw     *gzip.Writer
+}
+
+func (f *gzipFile) Write(p []byte) (int, error) { return f.zw.Write(p) }
+
+func (f *gzipFile) Close() error {
+	defer os.Remove(f.tmp.Name())
+	err := f.zw.Close()
+	if cerr := f.tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return writeToTarget(f.ctx, f.target, f.tmp.Name(), f.name)
+}
@@ -0,0 +1,207 @@
+package litebeam
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ConsistencyPolicy controls how NewLitebeam reacts when the shard files on
+// disk do not match the configured TotalShards.
+type ConsistencyPolicy int
+
+const (
+	// ConsistencyWarn logs any mismatch and carries on. Missing shards are
+	// created as usual.
+	ConsistencyWarn ConsistencyPolicy = iota
+	// ConsistencyFail makes NewLitebeam return an error on any mismatch.
+	ConsistencyFail
+	// ConsistencyRepair moves unreadable shard files aside so they are
+	// recreated, and recreates missing shards. Unexpected files are only
+	// logged, as removing them could lose data. With ReadOnly it behaves
+	// like ConsistencyWarn.
+	ConsistencyRepair
+)
+
+const corruptSuffix = ".corrupt"
+
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// ConsistencyReport lists the differences between the shard files found in
+// BasePath and the shards expected from TotalShards.
+type ConsistencyReport struct {
+	// Missing holds expected shard IDs with no file on disk. It is only
+	// filled in when at least one expected shard file exists, so a fresh
+	// BasePath is not reported as inconsistent, and never when shards are
+	// opened on demand, as shard files are then created on first use.
+	Missing []int
+	// Unreadable holds shard IDs whose file exists but is not a SQLite
+	// database.
+	Unreadable []int
+	// Unexpected holds the paths of shard files whose ID is outside 1..TotalShards,
+	// usually left behind after TotalShards was lowered. It is only filled
+	// in with the default file naming, not with ShardPathFunc.
+	Unexpected []string
+}
+
+// OK reports whether the files on disk match the configuration.
+func (r *ConsistencyReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Unreadable) == 0 && len(r.Unexpected) == 0
+}
+
+func (r *ConsistencyReport) String() string {
+	if r.OK() {
+		return "consistent"
+	}
+	var parts []string
+	if len(r.Missing) > 0 {
+		parts = append(parts, fmt.Sprintf("missing shards %v", r.Missing))
+	}
+	if len(r.Unreadable) > 0 {
+		parts = append(parts, fmt.Sprintf("unreadable shards %v", r.Unreadable))
+	}
+	if len(r.Unexpected) > 0 {
+		parts = append(parts, fmt.Sprintf("unexpected files %v", r.Unexpected))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// CheckConsistency compares the shard files in BasePath against TotalShards.
+func (l *Litebeam) CheckConsistency() (*ConsistencyReport, error) {
+	return checkConsistency(l.Config)
+}
+
+func checkConsistency(c *Config) (*ConsistencyReport, error) {
+	report := &ConsistencyReport{}
+	var missing []int
+	for id := 1; id <= c.TotalShards; id++ {
+		path := c.shardPath(id)
+		if _, err := os.Stat(path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				missing = append(missing, id)
+				continue
+			}
+			return nil, fmt.Errorf("error checking shard %d: %v", id, err)
+		}
+		if c.KeyProvider == nil && !isSQLiteFile(path) {
+			report.Unreadable = append(report.Unreadable, id)
+		}
+	}
+	if len(missing) < c.TotalShards && !c.lazy() {
+		report.Missing = missing
+	}
+
+	// Files left over from a larger TotalShards can only be recognised by
+	// name with the default naming.
+	if c.ShardPathFunc != nil {
+		return report, nil
+	}
+	dirs := []string{""}
+	if c.FanOutDirs {
+		dirs = dirs[:0]
+		for i := range 256 {
+			dirs = append(dirs, fmt.Sprintf("%02x/", i))
+		}
+	}
+	for _, base := range c.searchPaths() {
+		for _, dir := range dirs {
+			entries, err := os.ReadDir(base + dir)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				return nil, fmt.Errorf("error reading base path: %v", err)
+			}
+			for _, e := range entries {
+				id, ok := shardIDFromFile(e.Name())
+				if ok && (id < 1 || id > c.TotalShards) {
+					report.Unexpected = append(report.Unexpected, base+dir+e.Name())
+				}
+			}
+		}
+	}
+	return report, nil
+}
+
+// applyConsistencyPolicy runs the startup check and acts on the result
+// according to c.ConsistencyPolicy.
+func applyConsistencyPolicy(c *Config) error {
+	report, err := checkConsistency(c)
+	if err != nil {
+		return err
+	}
+	if report.OK() {
+		return nil
+	}
+
+	policy := c.ConsistencyPolicy
+	if policy == ConsistencyRepair && c.ReadOnly {
+		policy = ConsistencyWarn
+	}
+	switch policy {
+	case ConsistencyFail:
+		return fmt.Errorf("shard files do not match configuration: %s", report)
+	case ConsistencyRepair:
+		for _, id := range report.Unreadable {
+			path := c.shardPath(id)
+			if err := moveDBFiles(path, path+corruptSuffix); err != nil {
+				return fmt.Errorf("error moving aside unreadable shard %d: %v", id, err)
+			}
+		}
+		// Recorded placements would have these opened as missing rather
+		// than recreated.
+		for _, id := range slices.Concat(report.Unreadable, report.Missing) {
+			if err := c.placements.forget(c, id); err != nil {
+				return err
+			}
+		}
+		c.logger().Warn("repairing shard files", "report", report)
+	default:
+		c.logger().Warn("shard files do not match configuration", "report", report)
+	}
+	return nil
+}
+
+// shardIDFromFile parses the shard ID out of a file name produced by
+// dbFilePattern.
+func shardIDFromFile(name string) (int, bool) {
+	prefix, suffix, _ := strings.Cut(dbFilePattern, "%d")
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return 0, false
+	}
+	id, err := strconv.Atoi(name[len(prefix) : len(name)-len(suffix)])
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// isSQLiteFile reports whether path is a regular file that is either empty
+// or starts with the SQLite header. SQLite treats an empty file as an empty
+// database, so that case is fine.
+func isSQLiteFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	if info.Size() == 0 {
+		return true
+	}
+
+	header := make([]byte, len(sqliteHeader))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return bytes.Equal(header, sqliteHeader)
+}
@@ -0,0 +1,122 @@
+package litebeam
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// DatasetManifest describes every shard of a dataset, so a copy of its
+// files on another host can be checked with ImportManifest.
+type DatasetManifest struct {
+	CreatedAt   time.Time       `json:"created_at"`
+	TotalShards int             `json:"total_shards"`
+	Shards      []ShardManifest `json:"shards"`
+}
+
+// ShardManifest describes one shard's file in a DatasetManifest.
+type ShardManifest struct {
+	ShardID int `json:"shard_id"`
+	// Path is the file name relative to its base path, or the absolute
+	// path returned by ShardPathFunc.
+	Path          string `json:"path"`
+	Size          int64  `json:"size"`
+	SHA256        string `json:"sha256"`
+	Rows          int64  `json:"rows"`
+	SchemaVersion int    `json:"schema_version"`
+}
+
+// ExportManifest writes a JSON DatasetManifest of every shard to w. Each
+// shard's WAL is checkpointed first so its checksum covers all committed
+// data; the dataset should not be written to while this runs and until
+// its files have been copied.
+func (l *Litebeam) ExportManifest(ctx context.Context, w io.Writer) error {
+	manifest := DatasetManifest{
+		CreatedAt:   time.Now().UTC(),
+		TotalShards: l.Config.TotalShards,
+		Shards:      make([]ShardManifest, l.Config.TotalShards),
+	}
+	errs := l.fanOut(ctx, l.shardIDs(), 1, func(ctx context.Context, id int, s *Shard) error {
+		m, err := l.describeShard(ctx, id, s)
+		manifest.Shards[id-1] = m
+		return err
+	})
+	for _, id := range l.shardIDs() {
+		if err := errs[id]; err != nil {
+			return fmt.Errorf("error describing shard %d: %v", id, err)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(manifest)
+}
+
+// ImportManifest reads a DatasetManifest written by ExportManifest from r
+// and checks that the shards this Litebeam was opened on match it: the
+// same TotalShards, and for every shard the same file name, checksum, row
+// count and schema version. Call it on the new host after copying the
+// files and before writing to them. The returned error joins every
+// mismatch.
+func (l *Litebeam) ImportManifest(ctx context.Context, r io.Reader) error {
+	var want DatasetManifest
+	if err := json.NewDecoder(r).Decode(&want); err != nil {
+		return fmt.Errorf("error parsing dataset manifest: %v", err)
+	}
+	if want.TotalShards != l.Config.TotalShards {
+		return fmt.Errorf("dataset has %d shards, configured for %d", want.TotalShards, l.Config.TotalShards)
+	}
+
+	var mu sync.Mutex
+	got := make(map[int]ShardManifest, l.Config.TotalShards)
+	errs := l.fanOut(ctx, l.shardIDs(), 1, func(ctx context.Context, id int, s *Shard) error {
+		m, err := l.describeShard(ctx, id, s)
+		mu.Lock()
+		got[id] = m
+		mu.Unlock()
+		return err
+	})
+
+	var mismatches []error
+	for _, w := range want.Shards {
+		if err := errs[w.ShardID]; err != nil {
+			mismatches = append(mismatches, fmt.Errorf("shard %d: %w", w.ShardID, err))
+			continue
+		}
+		g, ok := got[w.ShardID]
+		switch {
+		case !ok:
+			mismatches = append(mismatches, fmt.Errorf("shard %d is out of range", w.ShardID))
+		case g.Path != w.Path:
+			mismatches = append(mismatches, fmt.Errorf("shard %d is at %s, manifest has %s", w.ShardID, g.Path, w.Path))
+		case g.SHA256 != w.SHA256 || g.Rows != w.Rows:
+			mismatches = append(mismatches, fmt.Errorf("shard %d does not match its checksum", w.ShardID))
+		case g.SchemaVersion != w.SchemaVersion:
+			mismatches = append(mismatches, fmt.Errorf("shard %d at version %d, manifest has %d", w.ShardID, g.SchemaVersion, w.SchemaVersion))
+		}
+	}
+	return errors.Join(mismatches...)
+}
+
+// describeShard checkpoints shard id and describes its file.
+func (l *Litebeam) describeShard(ctx context.Context, id int, s *Shard) (ShardManifest, error) {
+	m := ShardManifest{ShardID: id, Path: l.Config.shardName(id)}
+	if !s.readOnly {
+		if _, err := s.Writer.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			return m, err
+		}
+	}
+	var b ShardBackup
+	if err := describeBackup(ctx, l.Config.shardPath(id), s.key, &b); err != nil {
+		return m, err
+	}
+	m.Size, m.SHA256, m.Rows = b.Size, b.SHA256, b.Rows
+
+	var err error
+	m.SchemaVersion, err = schemaVersion(ctx, s.Reader)
+	return m, err
+}
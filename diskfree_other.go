@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd)
+
+package litebeam
+
+import "errors"
+
+func diskSpace(path string) (total, used, free uint64, err error) {
+	return 0, 0, 0, errors.ErrUnsupported
+}
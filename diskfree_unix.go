@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd
+
+package litebeam
+
+import "syscall"
+
+// diskSpace returns the size of the filesystem holding path, the space
+// used on it and the space available to unprivileged users.
+func diskSpace(path string) (total, used, free uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, 0, err
+	}
+	bsize := uint64(st.Bsize)
+	total = uint64(st.Blocks) * bsize
+	used = total - uint64(st.Bfree)*bsize
+	free = uint64(st.Bavail) * bsize
+	return total, used, free, nil
+}
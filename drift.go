@@ -0,0 +1,137 @@
+package litebeam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// SchemaObject is a table, index, view or trigger from sqlite_master.
+type SchemaObject struct {
+	Type string
+	Name string
+	// SQL is the CREATE statement with whitespace collapsed.
+	SQL string
+}
+
+// SchemaDrift lists how a shard's schema differs from the reference.
+type SchemaDrift struct {
+	ShardID int
+	// Missing and Extra hold object names absent from the shard or absent
+	// from the reference. Changed holds names whose definition differs.
+	Missing []string
+	Extra   []string
+	Changed []string
+}
+
+// ShardSchema returns the normalized schema of shard id, sorted by name.
+// SQLite's internal objects are left out.
+func (l *Litebeam) ShardSchema(ctx context.Context, id int) ([]SchemaObject, error) {
+	var objects []SchemaObject
+	err := l.withShard(id, func(s *Shard) error {
+		var err error
+		objects, err = readSchema(ctx, s)
+		return err
+	})
+	return objects, err
+}
+
+// CheckSchemaDrift compares every shard's schema with reference and returns
+// the shards that differ. A nil reference uses the schema of shard 1.
+func (l *Litebeam) CheckSchemaDrift(ctx context.Context, reference []SchemaObject) ([]SchemaDrift, error) {
+	if reference == nil {
+		var err error
+		reference, err = l.ShardSchema(ctx, 1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read reference schema: %w", err)
+		}
+	}
+
+	var mu sync.Mutex
+	schemas := make(map[int][]SchemaObject, l.Config.TotalShards)
+	results := l.fanOut(ctx, l.shardIDs(), runtime.GOMAXPROCS(0), func(ctx context.Context, id int, s *Shard) error {
+		objects, err := readSchema(ctx, s)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		schemas[id] = objects
+		mu.Unlock()
+		return nil
+	})
+
+	var drifts []SchemaDrift
+	var errs []error
+	for _, id := range l.shardIDs() {
+		if err := results[id]; err != nil {
+			errs = append(errs, fmt.Errorf("failed to read schema of shard %d: %w", id, err))
+			continue
+		}
+		if d := diffSchema(id, reference, schemas[id]); d != nil {
+			drifts = append(drifts, *d)
+		}
+	}
+	return drifts, errors.Join(errs...)
+}
+
+func readSchema(ctx context.Context, s *Shard) ([]SchemaObject, error) {
+	rows, err := s.Reader.QueryContext(ctx, `
+		SELECT type, name, sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' AND name != 'shard_labels'
+		ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var objects []SchemaObject
+	for rows.Next() {
+		var o SchemaObject
+		if err := rows.Scan(&o.Type, &o.Name, &o.SQL); err != nil {
+			return nil, err
+		}
+		o.SQL = strings.Join(strings.Fields(o.SQL), " ")
+		objects = append(objects, o)
+	}
+	return objects, rows.Err()
+}
+
+// diffSchema returns nil when got matches want.
+func diffSchema(id int, want, got []SchemaObject) *SchemaDrift {
+	index := func(objects []SchemaObject) map[string]SchemaObject {
+		m := make(map[string]SchemaObject, len(objects))
+		for _, o := range objects {
+			m[o.Name] = o
+		}
+		return m
+	}
+	wantByName, gotByName := index(want), index(got)
+
+	d := SchemaDrift{ShardID: id}
+	for name, w := range wantByName {
+		g, ok := gotByName[name]
+		switch {
+		case !ok:
+			d.Missing = append(d.Missing, name)
+		case g != w:
+			d.Changed = append(d.Changed, name)
+		}
+	}
+	for name := range gotByName {
+		if _, ok := wantByName[name]; !ok {
+			d.Extra = append(d.Extra, name)
+		}
+	}
+
+	if len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Changed) == 0 {
+		return nil
+	}
+	slices.Sort(d.Missing)
+	slices.Sort(d.Extra)
+	slices.Sort(d.Changed)
+	return &d
+}
@@ -0,0 +1,186 @@
+package litebeam
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/ncruces/go-sqlite3/driver"
+	_ "github.com/ncruces/go-sqlite3/vfs/adiantum"
+)
+
+// keySize is the key length of the adiantum VFS.
+const keySize = 32
+
+// KeyProvider supplies the encryption key of each shard, for example from
+// a KMS. Keys must be 32 bytes.
+type KeyProvider interface {
+	KeyFor(shardID int) ([]byte, error)
+}
+
+// shardKey returns the key of shard id from keys, or nil without keys.
+func shardKey(keys KeyProvider, id int) ([]byte, error) {
+	if keys == nil {
+		return nil, nil
+	}
+	key, err := keys.KeyFor(id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting key for shard %d: %v", id, err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key for shard %d is %d bytes, want %d", id, len(key), keySize)
+	}
+	return key, nil
+}
+
+// addKey adds the parameters that open a file through the encrypting VFS
+// with key. A nil key adds nothing.
+func addKey(params url.Values, key []byte) {
+	if key != nil {
+		params.Add("vfs", "adiantum")
+		params.Add("hexkey", hex.EncodeToString(key))
+	}
+}
+
+// sqlName returns how statements such as ATTACH and VACUUM INTO must name
+// the database file at path so it is encrypted with key.
+func sqlName(path string, key []byte) string {
+	if key == nil {
+		return path
+	}
+	params := url.Values{}
+	addKey(params, key)
+	return fileURI(path, params)
+}
+
+// readOnlyName is sqlName for opening or attaching path read-only.
+func readOnlyName(path string, key []byte) string {
+	params := url.Values{"mode": {"ro"}}
+	addKey(params, key)
+	return fileURI(path, params)
+}
+
+// fileURI returns the SQLite URI filename for path with params, escaping
+// the characters of path that URIs give a meaning to, such as ? and #.
+func fileURI(path string, params url.Values) string {
+	u := url.URL{Scheme: "file", Path: path, OmitHost: true, RawQuery: params.Encode()}
+	return u.String()
+}
+
+// openFile opens the database file at path read-only, decrypting it with
+// key if set.
+func openFile(path string, key []byte) (*sql.DB, error) {
+	return driver.Open(readOnlyName(path, key))
+}
+
+// KeyRotator is a KeyProvider that can store a new key for a shard, as
+// RotateShardKey needs.
+type KeyRotator interface {
+	KeyProvider
+	// SetKey makes key the current key of the shard, so KeyFor returns it
+	// from then on. Providers that version keys should keep the previous
+	// version until RotateShardKey returns, as the shard file is only
+	// replaced after SetKey succeeds, and SetKey is called again with the
+	// previous key if replacing it fails.
+	SetKey(shardID int, key []byte) error
+}
+
+// RotateShardKey re-encrypts shard id with newKey. The shard is closed,
+// copied with VACUUM INTO to a file encrypted with newKey, checked with
+// quick_check, and swapped into place after the KeyProvider, which must
+// implement KeyRotator, has stored the new key. If the swap fails, the
+// old key is stored again and the old file is left as it was. Requests
+// for the shard fail with ErrShardMoving while this runs, and a leased
+// shard cannot be rotated.
+func (l *Litebeam) RotateShardKey(ctx context.Context, id int, newKey []byte) error {
+	if err := l.writable(); err != nil {
+		return err
+	}
+	rotator, ok := l.Config.KeyProvider.(KeyRotator)
+	if !ok {
+		return errors.New("KeyProvider does not implement KeyRotator")
+	}
+	if len(newKey) != keySize {
+		return fmt.Errorf("new key is %d bytes, want %d", len(newKey), keySize)
+	}
+	oldKey, err := shardKey(rotator, id)
+	if err != nil {
+		return err
+	}
+
+	done, err := l.detachShard(id, true)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	path := l.Config.shardPath(id)
+	tmp := path + ".rekey"
+	if err := removeDBFiles(tmp); err != nil {
+		return err
+	}
+	defer removeDBFiles(tmp)
+
+	db, err := openFile(path, oldKey)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, "VACUUM INTO ?", sqlName(tmp, newKey))
+	db.Close()
+	if err != nil {
+		return fmt.Errorf("error re-encrypting shard %d: %v", id, err)
+	}
+	if err := quickCheck(ctx, tmp, newKey); err != nil {
+		return fmt.Errorf("error re-encrypting shard %d: %v", id, err)
+	}
+
+	if err := rotator.SetKey(id, newKey); err != nil {
+		return fmt.Errorf("error storing new key for shard %d: %v", id, err)
+	}
+	if err := replaceShardFile(tmp, path); err != nil {
+		// The old file is still in place, so the old key must be too.
+		if rerr := rotator.SetKey(id, oldKey); rerr != nil {
+			rerr = fmt.Errorf("error restoring old key for shard %d: %v", id, rerr)
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// replaceShardFile renames src over the database file path, dropping the
+// WAL and shared memory files of the old one first.
+func replaceShardFile(src, path string) error {
+	for _, p := range []string{path + "-wal", path + "-shm"} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(src, path)
+}
+
+// RotateKeys re-encrypts every shard, one at a time, with the key newKey
+// returns for it, calling progress, if set, after each shard. It carries
+// on past failing shards and returns the result per shard ID.
+func (l *Litebeam) RotateKeys(ctx context.Context, newKey func(shardID int) ([]byte, error), progress func(ShardProgress)) map[int]error {
+	ids := l.shardIDs()
+	results := make(map[int]error, len(ids))
+	for i, id := range ids {
+		err := ctx.Err()
+		if err == nil {
+			var key []byte
+			if key, err = newKey(id); err == nil {
+				err = l.RotateShardKey(ctx, id, key)
+			}
+		}
+		results[id] = err
+		if progress != nil {
+			progress(ShardProgress{ShardID: id, Done: i + 1, Total: len(ids), Err: err})
+		}
+	}
+	return results
+}
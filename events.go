@@ -0,0 +1,170 @@
+package litebeam
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// EventType names a lifecycle event.
+type EventType string
+
+// Lifecycle events delivered by Subscribe.
+const (
+	EventShardCreated       EventType = "shard_created"
+	EventShardRestored      EventType = "shard_restored"
+	EventShardQuarantined   EventType = "shard_quarantined"
+	EventShardUnquarantined EventType = "shard_unquarantined"
+	EventWALOverThreshold   EventType = "wal_over_threshold"
+)
+
+const (
+	// defaultEventBuffer is the channel size of each subscription.
+	defaultEventBuffer = 64
+	// recentEvents is the number of events kept for RecentEvents.
+	recentEvents = 50
+)
+
+// Event is a lifecycle event of a shard.
+type Event struct {
+	Type    EventType
+	ShardID int
+	Time    time.Time
+	// Path is the new file for EventShardCreated and the backup restored
+	// from for EventShardRestored.
+	Path string
+	// Err is the reason for EventShardQuarantined.
+	Err error
+	// Size is the WAL size in bytes for EventWALOverThreshold.
+	Size int64
+}
+
+// subscriptions holds the channels returned by Subscribe and the latest
+// events.
+type subscriptions struct {
+	mu     sync.Mutex
+	chans  map[chan Event]struct{}
+	closed bool
+	recent []Event
+}
+
+// RecentEvents returns the last 50 lifecycle events, oldest first.
+func (l *Litebeam) RecentEvents() []Event {
+	l.subs.mu.Lock()
+	defer l.subs.mu.Unlock()
+	return slices.Clone(l.subs.recent)
+}
+
+// Subscribe returns a channel delivering every lifecycle event from now
+// on, the same events the On* callbacks of Config see, and a cancel func
+// that ends the subscription and closes the channel. The channel holds
+// Config.EventBuffer events; events that arrive while it is full are
+// dropped, not waited for, and counted on the MetricsSink as
+// "events.dropped". Close ends every subscription.
+func (l *Litebeam) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, l.Config.eventBuffer())
+	subs := &l.subs
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+	if subs.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if subs.chans == nil {
+		subs.chans = map[chan Event]struct{}{}
+	}
+	subs.chans[ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			subs.mu.Lock()
+			defer subs.mu.Unlock()
+			if _, ok := subs.chans[ch]; ok {
+				delete(subs.chans, ch)
+				close(ch)
+			}
+		})
+	}
+}
+
+func (c *Config) eventBuffer() int {
+	if c.EventBuffer > 0 {
+		return c.EventBuffer
+	}
+	return defaultEventBuffer
+}
+
+// emit delivers e to every subscription without blocking.
+func (l *Litebeam) emit(e Event) {
+	e.Time = time.Now().UTC()
+	subs := &l.subs
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+	if len(subs.recent) == recentEvents {
+		subs.recent = slices.Delete(subs.recent, 0, 1)
+	}
+	subs.recent = append(subs.recent, e)
+	for ch := range subs.chans {
+		select {
+		case ch <- e:
+		default:
+			l.Config.sink().Counter("events.dropped", e.ShardID, 1)
+		}
+	}
+}
+
+// closeSubscriptions ends every subscription, for Close.
+func (l *Litebeam) closeSubscriptions() {
+	subs := &l.subs
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+	for ch := range subs.chans {
+		close(ch)
+	}
+	subs.chans = nil
+	subs.closed = true
+}
+
+// afterUnlock queues fn to run once l.mu is released by the method that
+// holds it, so callbacks never run with the lock held. l.mu must be held.
+func (l *Litebeam) afterUnlock(fn func()) {
+	l.pending = append(l.pending, fn)
+}
+
+// runPending runs the callbacks queued by afterUnlock. Methods that can
+// queue callbacks defer it before locking l.mu, so it runs after unlock.
+func (l *Litebeam) runPending() {
+	l.mu.Lock()
+	pending := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+	for _, fn := range pending {
+		fn()
+	}
+}
+
+// shardCreated reports that the file of shard id was just created.
+func (l *Litebeam) shardCreated(id int) {
+	path := l.Config.shardPath(id)
+	l.emit(Event{Type: EventShardCreated, ShardID: id, Path: path})
+	if l.Config.OnShardCreated != nil {
+		l.Config.OnShardCreated(ShardInfo{ID: id, Path: path, Created: true})
+	}
+}
+
+// shardRestored reports that shard id was just restored from src.
+func (l *Litebeam) shardRestored(id int, src string) {
+	l.emit(Event{Type: EventShardRestored, ShardID: id, Path: src})
+	if l.Config.OnShardRestored != nil {
+		l.Config.OnShardRestored(id, src)
+	}
+}
+
+// shardQuarantined reports that shard id was just quarantined.
+func (l *Litebeam) shardQuarantined(id int, reason error) {
+	l.emit(Event{Type: EventShardQuarantined, ShardID: id, Err: reason})
+	if l.Config.OnQuarantine != nil {
+		l.Config.OnQuarantine(id, reason)
+	}
+}
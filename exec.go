@@ -0,0 +1,54 @@
+package litebeam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// ExecResult is the outcome of ExecOnAll on one shard.
+type ExecResult struct {
+	RowsAffected int64
+	Err          error
+}
+
+// ExecOnAll runs query with args on the writer of every shard that is not
+// quarantined, up to GOMAXPROCS shards at once, for fleet-wide schema
+// changes, fixups and backfills. Each shard runs it separately, so a
+// failure on one shard does not undo it on the others. The result holds
+// an entry per shard run; the error joins every failure, each wrapped with
+// its shard ID.
+func (l *Litebeam) ExecOnAll(ctx context.Context, query string, args ...any) (map[int]ExecResult, error) {
+	if err := l.writable(); err != nil {
+		return nil, err
+	}
+	ids := l.activeShardIDs()
+
+	var mu sync.Mutex
+	results := make(map[int]ExecResult, len(ids))
+	errs := l.fanOut(ctx, ids, runtime.GOMAXPROCS(0), func(ctx context.Context, id int, s *Shard) error {
+		res, err := s.Writer.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		results[id] = ExecResult{RowsAffected: n}
+		mu.Unlock()
+		return nil
+	})
+
+	var failed []error
+	for _, id := range ids {
+		if err := errs[id]; err != nil {
+			results[id] = ExecResult{Err: err}
+			failed = append(failed, fmt.Errorf("shard %d: %w", id, err))
+		}
+	}
+	return results, errors.Join(failed...)
+}
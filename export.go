@@ -0,0 +1,91 @@
+package litebeam
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// ExportFormat is a file format ExportTable can write.
+type ExportFormat int
+
+const (
+	// ExportCSV writes RFC 4180 CSV with a header row. NULL is written as
+	// an empty field and blobs as their raw bytes.
+	ExportCSV ExportFormat = iota
+)
+
+// ExportTable streams every row of table across all shards to w in format,
+// shard by shard in ID order, with a leading shard_id column. Each shard is
+// read in one query, so it is consistent with itself. Every shard must have
+// the table with the same columns, in the same order, as shard 1.
+func (l *Litebeam) ExportTable(ctx context.Context, table string, format ExportFormat, w io.Writer) error {
+	if format != ExportCSV {
+		return fmt.Errorf("unknown export format %d", format)
+	}
+	cw := csv.NewWriter(w)
+
+	var header []string
+	for _, id := range l.shardIDs() {
+		err := l.withShard(id, func(s *Shard) error {
+			rows, err := s.NextReader().QueryContext(ctx, "SELECT * FROM "+quoteIdent(table))
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			cols, err := rows.Columns()
+			if err != nil {
+				return err
+			}
+			if header == nil {
+				header = cols
+				if err := cw.Write(append([]string{"shard_id"}, cols...)); err != nil {
+					return err
+				}
+			} else if !slices.Equal(cols, header) {
+				return fmt.Errorf("columns %v differ from shard 1's %v", cols, header)
+			}
+
+			values := make([]any, len(cols))
+			ptrs := make([]any, len(cols))
+			for i := range values {
+				ptrs[i] = &values[i]
+			}
+			record := make([]string, len(cols)+1)
+			record[0] = strconv.Itoa(id)
+			for rows.Next() {
+				if err := rows.Scan(ptrs...); err != nil {
+					return err
+				}
+				for i, v := range values {
+					record[i+1] = csvField(v)
+				}
+				if err := cw.Write(record); err != nil {
+					return err
+				}
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return fmt.Errorf("error exporting %s from shard %d: %v", table, id, err)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvField(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
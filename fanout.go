@@ -0,0 +1,156 @@
+package litebeam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shardIDs returns every configured shard ID in order.
+func (l *Litebeam) shardIDs() []int {
+	ids := make([]int, l.Config.TotalShards)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	return ids
+}
+
+// RangeShards calls fn for every shard in ID order, opening shards on
+// demand and leasing each one while fn runs. Quarantined shards are
+// skipped. It stops at the first error, which is returned.
+func (l *Litebeam) RangeShards(fn func(id int, s *Shard) error) error {
+	for _, id := range l.activeShardIDs() {
+		if err := l.withShard(id, func(s *Shard) error { return fn(id, s) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachShard calls fn for every shard that is not quarantined, with at
+// most concurrency calls running at once, opening shards on demand and
+// leasing each one while fn runs. Unlike RangeShards it carries on past
+// errors, and returns them joined in shard ID order, each wrapped with its
+// shard ID. Once ctx is done the remaining shards are skipped with its
+// error. Concurrency below 1 is treated as 1 and is capped at
+// MaxOpenShards and ConnBudget when those are set.
+func (l *Litebeam) ForEachShard(ctx context.Context, concurrency int, fn func(id int, s *Shard) error) error {
+	ids := l.activeShardIDs()
+	results := l.fanOut(ctx, ids, concurrency, func(ctx context.Context, id int, s *Shard) error {
+		return fn(id, s)
+	})
+	var errs []error
+	for _, id := range ids {
+		if err := results[id]; err != nil {
+			errs = append(errs, fmt.Errorf("shard %d: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fanOut runs fn for every shard in ids with at most concurrency shards in
+// flight, leasing each shard for the duration of its call. The result holds
+// an entry for every ID, nil on success. Concurrency below 1 is treated as
+// 1 and is capped at MaxOpenShards and ConnBudget when those are set, as
+// every open shard holds at least one connection. A shard that cannot be
+// opened for lack of room is waited for rather than failed with
+// ErrOpenLimit, as leases held elsewhere may be released.
+func (l *Litebeam) fanOut(ctx context.Context, ids []int, concurrency int, fn func(ctx context.Context, id int, s *Shard) error) map[int]error {
+	return l.fanOutUntil(ctx, ids, concurrency, false, fn)
+}
+
+// fanOutUntil is fanOut that, with stopOnError set, starts no more shards
+// once one has failed, whether it could not be opened or fn returned an
+// error. Shards that were not started have no entry in the result.
+func (l *Litebeam) fanOutUntil(ctx context.Context, ids []int, concurrency int, stopOnError bool, fn func(ctx context.Context, id int, s *Shard) error) map[int]error {
+	concurrency = max(concurrency, 1)
+	if l.Config.MaxOpenShards > 0 {
+		concurrency = min(concurrency, l.Config.MaxOpenShards)
+	}
+	if l.Config.ConnBudget > 0 {
+		concurrency = min(concurrency, l.Config.ConnBudget)
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		failed  atomic.Bool
+		results = make(map[int]error, len(ids))
+		work    = make(chan int)
+	)
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range work {
+				if stopOnError && failed.Load() {
+					continue
+				}
+				err := ctx.Err()
+				if err == nil {
+					err = l.withShardWait(ctx, id, func(s *Shard) error {
+						return fn(ctx, id, s)
+					})
+				}
+				if err != nil {
+					failed.Store(true)
+				}
+				mu.Lock()
+				results[id] = err
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, id := range ids {
+		work <- id
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
+
+// withShard leases shard id for the duration of fn.
+func (l *Litebeam) withShard(id int, fn func(s *Shard) error) error {
+	s, release, err := l.AcquireShard(id)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn(s)
+}
+
+// openRetryInterval bounds how long withShardWait waits for a lease
+// release before trying again, as idle connections can free room too.
+const openRetryInterval = 50 * time.Millisecond
+
+// withShardWait is withShard, waiting until ctx is done for room to open
+// the shard instead of failing with ErrOpenLimit.
+func (l *Litebeam) withShardWait(ctx context.Context, id int, fn func(s *Shard) error) error {
+	for {
+		l.mu.Lock()
+		released := l.released
+		l.mu.Unlock()
+
+		s, release, err := l.AcquireShard(id)
+		if err == nil {
+			defer release()
+			return fn(s)
+		}
+		if !errors.Is(err, ErrOpenLimit) {
+			return err
+		}
+		t := time.NewTimer(openRetryInterval)
+		select {
+		case <-released:
+		case <-t.C:
+		case <-ctx.Done():
+		}
+		t.Stop()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package litebeam
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned when a shard is requested after Close.
+var ErrClosed = errors.New("litebeam is closed")
+
+// ErrOpenLimit is returned by GetShard when opening another shard would
+// exceed MaxOpenShards or ConnBudget and no idle shard can be closed to
+// make room.
+var ErrOpenLimit = errors.New("open shard limit reached")
+
+var (
+	// ErrShardMissing is returned when a shard that cannot be created, such
+	// as a read-only one, or one created before on a volume that has gone
+	// missing, has no file on disk.
+	ErrShardMissing = errors.New("shard file is missing")
+	// ErrShardCorrupt is returned when a shard file is not a valid SQLite
+	// database.
+	ErrShardCorrupt = errors.New("shard file is corrupt")
+	// ErrReadOnly is returned when a write is attempted on a read-only
+	// shard, or by any mutating method when Config.ReadOnly is set.
+	ErrReadOnly = errors.New("read-only")
+	// ErrShardMoving is returned when a shard is requested while its file
+	// is being moved or restored.
+	ErrShardMoving = errors.New("shard is being moved")
+)
+
+// ShardError is returned when a shard fails validation or cannot be opened.
+// Use errors.Is with ErrShardMissing or ErrShardCorrupt to tell the causes
+// apart.
+type ShardError struct {
+	ID   int
+	Path string
+	Err  error
+}
+
+func (e *ShardError) Error() string {
+	return fmt.Sprintf("shard %d (%s): %v", e.ID, e.Path, e.Err)
+}
+
+func (e *ShardError) Unwrap() error {
+	return e.Err
+}
+
+// validateShardFile checks a shard's file before it is opened and reports
+// whether it exists. A missing file is only an error when it must exist,
+// as for read-only shards and shards created before.
+func validateShardFile(id int, path string, mustExist, encrypted bool) (bool, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if mustExist {
+			return false, &ShardError{ID: id, Path: path, Err: ErrShardMissing}
+		}
+		return false, nil
+	}
+	// Encrypted files have no plain header to check.
+	if !encrypted && !isSQLiteFile(path) {
+		return true, &ShardError{ID: id, Path: path, Err: ErrShardCorrupt}
+	}
+	return true, nil
+}
+
+// GetShard returns the cached handles for shard id, opening them first if
+// they are not open yet. The returned handles are owned by the Litebeam and
+// must not be closed by the caller. With MaxOpenShards or ConnBudget set,
+// handles may be closed once the shard is evicted, so callers should not
+// hold on to them; use AcquireShard instead.
+func (l *Litebeam) GetShard(id int) (*Shard, error) {
+	defer l.runPending()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.getShardLocked(id)
+}
+
+// AcquireShard returns the handles for shard id like GetShard, and keeps
+// the shard from being evicted or closed for idleness until release is
+// called. release is safe to call more than once.
+func (l *Litebeam) AcquireShard(id int) (*Shard, func(), error) {
+	defer l.runPending()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s, err := l.getShardLocked(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.leases++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			s.leases--
+			s.lastUsed = time.Now()
+			close(l.released)
+			l.released = make(chan struct{})
+		})
+	}
+	return s, release, nil
+}
+
+// getShardLocked returns the open shard id, opening it if needed. l.mu must
+// be held, and released before runPending. l.mu is released while the
+// shard is opened, so callers must not rely on state read before the call.
+func (l *Litebeam) getShardLocked(id int) (*Shard, error) {
+	l.waitOpeningLocked(id)
+	if err := l.checkShardLocked(id); err != nil {
+		return nil, err
+	}
+	// Quarantined shards can still be detached, so they can be restored.
+	if reason, ok := l.quarantined[id]; ok {
+		return nil, fmt.Errorf("shard %d: %w: %v", id, ErrShardQuarantined, reason)
+	}
+	l.recordTrafficLocked(id)
+	if s, ok := l.Shards[id]; ok {
+		l.lru.touch(id)
+		s.lastUsed = time.Now()
+		return s, nil
+	}
+
+	if !l.makeRoomLocked() {
+		return nil, ErrOpenLimit
+	}
+	// Open the shard without holding l.mu, so requests for other shards
+	// are not held up by it. Requests for this one wait in
+	// waitOpeningLocked until it is installed.
+	opened := make(chan struct{})
+	l.opening[id] = opened
+	l.mu.Unlock()
+	start := time.Now()
+	s, err := openShard(l.Config, id)
+	l.recordOpen(id, s, err, time.Since(start))
+	l.mu.Lock()
+	delete(l.opening, id)
+	close(opened)
+	if err != nil {
+		return nil, err
+	}
+	// Close and Quarantine may have run while l.mu was released.
+	if l.closed {
+		_ = closeShard(id, s)
+		return nil, ErrClosed
+	}
+	if reason, ok := l.quarantined[id]; ok {
+		_ = closeShard(id, s)
+		return nil, fmt.Errorf("shard %d: %w: %v", id, ErrShardQuarantined, reason)
+	}
+
+	s.lastUsed = time.Now()
+	l.Shards[id] = s
+	l.lru.touch(id)
+	// The file may have been replaced while the shard was closed, such as
+	// from its mirror, so its schema version is checked again.
+	delete(l.current, id)
+	l.reportOpenLocked()
+	if s.created {
+		l.afterUnlock(func() { l.shardCreated(id) })
+	}
+	return s, nil
+}
+
+// waitOpeningLocked waits, releasing l.mu meanwhile, until shard id is not
+// being opened by another caller. l.mu must be held.
+func (l *Litebeam) waitOpeningLocked(id int) {
+	for {
+		opened, ok := l.opening[id]
+		if !ok {
+			return
+		}
+		l.mu.Unlock()
+		<-opened
+		l.mu.Lock()
+	}
+}
+
+// waitAllOpeningLocked waits, releasing l.mu meanwhile, until no shard is
+// being opened. l.mu must be held.
+func (l *Litebeam) waitAllOpeningLocked() {
+	for len(l.opening) > 0 {
+		for id := range l.opening {
+			l.waitOpeningLocked(id)
+			break
+		}
+	}
+}
+
+// detachShard closes shard id and keeps it from being opened again until
+// done is called, so its file can be replaced. With open set the shard is
+// opened first if it is not open yet, which replays any WAL left behind.
+// A leased shard cannot be detached.
+func (l *Litebeam) detachShard(id int, open bool) (done func(), err error) {
+	defer l.runPending()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if open {
+		if _, err := l.getShardLocked(id); err != nil {
+			return nil, err
+		}
+	} else {
+		l.waitOpeningLocked(id)
+		if err := l.checkShardLocked(id); err != nil {
+			return nil, err
+		}
+	}
+	if s, ok := l.Shards[id]; ok {
+		if s.leases > 0 {
+			return nil, fmt.Errorf("shard %d is in use", id)
+		}
+		l.closeShardLocked(id, s)
+	}
+	l.moving[id] = true
+	// Restores and moves can replace the file with one at another schema
+	// version.
+	delete(l.current, id)
+
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.moving, id)
+	}, nil
+}
+
+// writable returns ErrReadOnly when the Litebeam was opened with ReadOnly.
+func (l *Litebeam) writable() error {
+	if l.Config.ReadOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// checkShardLocked returns an error if shard id cannot be used right now.
+// l.mu must be held.
+func (l *Litebeam) checkShardLocked(id int) error {
+	if id < 1 || id > l.Config.TotalShards {
+		return fmt.Errorf("shard %d out of range 1..%d", id, l.Config.TotalShards)
+	}
+	if l.closed {
+		return ErrClosed
+	}
+	if l.moving[id] {
+		return ErrShardMoving
+	}
+	return nil
+}
+
+// OpenCounts returns how many shards are open and how many connections
+// they hold in total.
+func (l *Litebeam) OpenCounts() (shards, conns int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.Shards), l.openConnsLocked()
+}
+
+// makeRoomLocked closes idle shards, least recently used first, until one
+// more shard can be opened within MaxOpenShards and ConnBudget. It reports
+// whether there is room. l.mu must be held.
+func (l *Litebeam) makeRoomLocked() bool {
+	full := func() bool {
+		// Shards being opened count as open.
+		opening := len(l.opening)
+		if l.Config.MaxOpenShards > 0 && len(l.Shards)+opening >= l.Config.MaxOpenShards {
+			return true
+		}
+		// Opening a shard keeps at least one writer connection open.
+		return l.Config.ConnBudget > 0 && l.openConnsLocked()+opening+1 > l.Config.ConnBudget
+	}
+
+	for _, id := range l.lru.oldestFirst() {
+		if !full() {
+			return true
+		}
+		s, ok := l.Shards[id]
+		if !ok {
+			l.lru.remove(id)
+			continue
+		}
+		if !s.evictable() {
+			continue
+		}
+		l.closeShardLocked(id, s)
+	}
+	return !full()
+}
+
+// closeIdle closes shards that have not been used or leased for longer
+// than ShardIdleTTL.
+func (l *Litebeam) closeIdle() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := time.Now().Add(-l.Config.ShardIdleTTL)
+	for id, s := range l.Shards {
+		if s.evictable() && s.lastUsed.Before(cutoff) {
+			l.closeShardLocked(id, s)
+		}
+	}
+}
+
+// closeShardLocked closes an open shard and forgets it. l.mu must be held.
+func (l *Litebeam) closeShardLocked(id int, s *Shard) {
+	_ = closeShard(id, s)
+	delete(l.Shards, id)
+	l.lru.remove(id)
+	l.reportOpenLocked()
+}
+
+// openConnsLocked sums the open connections of every open shard. l.mu must
+// be held.
+func (l *Litebeam) openConnsLocked() int {
+	n := 0
+	for _, s := range l.Shards {
+		for _, db := range s.dbs() {
+			n += db.Stats().OpenConnections
+		}
+	}
+	return n
+}
+
+// openShards returns a snapshot of the currently open shards.
+func (l *Litebeam) openShards() map[int]*Shard {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return maps.Clone(l.Shards)
+}
@@ -0,0 +1,160 @@
+package litebeam
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// PingAll pings every pool of every shard, with at most concurrency shards
+// pinged at once, and returns the result per shard ID. A nil entry means
+// the shard is reachable. With AutoQuarantine, corrupt shards are
+// quarantined.
+func (l *Litebeam) PingAll(ctx context.Context, concurrency int) map[int]error {
+	results := l.fanOut(ctx, l.shardIDs(), concurrency, func(ctx context.Context, id int, s *Shard) error {
+		return pingShard(ctx, s)
+	})
+	l.quarantineCorrupt(results)
+	return results
+}
+
+// pingShard pings every pool of s.
+func pingShard(ctx context.Context, s *Shard) error {
+	for _, db := range s.dbs() {
+		if err := db.PingContext(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IntegrityCheckAll runs PRAGMA integrity_check on every shard, with at
+// most concurrency shards checked at once, and returns the result per
+// shard ID. A nil entry means the shard is intact; otherwise the error
+// lists every problem found, or why the shard could not be opened. With
+// AutoQuarantine, corrupt shards are quarantined.
+func (l *Litebeam) IntegrityCheckAll(ctx context.Context, concurrency int) map[int]error {
+	return l.checkAll(ctx, concurrency, "integrity_check")
+}
+
+// QuickCheckAll is IntegrityCheckAll using PRAGMA quick_check, which skips
+// the index checks and is much faster on large shards.
+func (l *Litebeam) QuickCheckAll(ctx context.Context, concurrency int) map[int]error {
+	return l.checkAll(ctx, concurrency, "quick_check")
+}
+
+func (l *Litebeam) checkAll(ctx context.Context, concurrency int, pragma string) map[int]error {
+	results := l.fanOut(ctx, l.shardIDs(), concurrency, func(ctx context.Context, id int, s *Shard) error {
+		return checkDB(ctx, s.NextReader(), pragma)
+	})
+	l.quarantineCorrupt(results)
+	return results
+}
+
+// HealthOptions tunes HealthCheck.
+type HealthOptions struct {
+	// Concurrency is the number of shards checked at once. Defaults to 1.
+	Concurrency int
+	// QuickCheck also runs PRAGMA quick_check on every reachable shard.
+	QuickCheck bool
+}
+
+// Health is the result of HealthCheck. There is no separate metadata
+// database to report on: shards are the only state litebeam keeps.
+type Health struct {
+	CheckedAt time.Time `json:"checked_at"`
+	// Healthy is true when every shard that is not being moved is
+	// reachable, passed its quick check if one was run, and is not
+	// quarantined.
+	Healthy bool          `json:"healthy"`
+	Shards  []ShardHealth `json:"shards"`
+}
+
+// ShardHealth describes one shard in Health.
+type ShardHealth struct {
+	ShardID int `json:"shard_id"`
+	// Status is StatusOpen, StatusClosed, StatusMoving or
+	// StatusQuarantined, as it was before HealthCheck opened the shard.
+	Status string `json:"status"`
+	// Reachable is true when every pool of the shard answered a ping.
+	Reachable bool `json:"reachable"`
+	// QuickChecked is true when the shard passed PRAGMA quick_check.
+	QuickChecked bool `json:"quick_checked"`
+	// Error is why the shard is unhealthy now, including the reason it
+	// was quarantined.
+	Error string `json:"error,omitempty"`
+	// LastError and LastErrorAt are the last failure any HealthCheck saw
+	// on the shard, which may since have cleared.
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// shardFailure is a failure recorded by HealthCheck.
+type shardFailure struct {
+	err error
+	at  time.Time
+}
+
+// HealthCheck pings every shard, and quick checks it if asked, and
+// reports the result per shard, for feeding into a service health
+// framework. Quarantined and moving shards are not opened. With
+// AutoQuarantine, corrupt shards are quarantined.
+func (l *Litebeam) HealthCheck(ctx context.Context, opts HealthOptions) *Health {
+	h := &Health{
+		CheckedAt: time.Now().UTC(),
+		Healthy:   true,
+		Shards:    make([]ShardHealth, l.Config.TotalShards),
+	}
+
+	var reachable []int
+	l.mu.Lock()
+	for _, id := range l.shardIDs() {
+		sh := &h.Shards[id-1]
+		sh.ShardID, sh.Status = id, l.statusLocked(id)
+		switch sh.Status {
+		case StatusQuarantined:
+			sh.Error = l.quarantined[id].Error()
+		case StatusOpen, StatusClosed:
+			reachable = append(reachable, id)
+		}
+	}
+	l.mu.Unlock()
+
+	var mu sync.Mutex
+	results := l.fanOut(ctx, reachable, opts.Concurrency, func(ctx context.Context, id int, s *Shard) error {
+		if err := pingShard(ctx, s); err != nil {
+			return err
+		}
+		mu.Lock()
+		h.Shards[id-1].Reachable = true
+		mu.Unlock()
+		if !opts.QuickCheck {
+			return nil
+		}
+		if err := checkDB(ctx, s.NextReader(), "quick_check"); err != nil {
+			return err
+		}
+		mu.Lock()
+		h.Shards[id-1].QuickChecked = true
+		mu.Unlock()
+		return nil
+	})
+	l.quarantineCorrupt(results)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range h.Shards {
+		sh := &h.Shards[i]
+		if err := results[sh.ShardID]; err != nil {
+			sh.Error = err.Error()
+			l.failures[sh.ShardID] = shardFailure{err: err, at: h.CheckedAt}
+		}
+		if f, ok := l.failures[sh.ShardID]; ok {
+			sh.LastError, sh.LastErrorAt = f.err.Error(), &f.at
+		}
+		if sh.Error != "" {
+			h.Healthy = false
+		}
+	}
+	return h
+}
@@ -0,0 +1,101 @@
+package litebeam
+
+import (
+	"slices"
+	"time"
+)
+
+// Shard traffic is counted in one-minute buckets covering the last hour.
+const (
+	trafficBucket  = time.Minute
+	trafficBuckets = 60
+)
+
+// shardTraffic counts the handle requests for one shard per bucket.
+// Guarded by Litebeam.mu.
+type shardTraffic struct {
+	counts [trafficBuckets]uint32
+	// epochs holds the bucket number each count belongs to, so stale
+	// counts are ignored and reset lazily.
+	epochs [trafficBuckets]int64
+}
+
+func (t *shardTraffic) add(now time.Time) {
+	epoch := now.UnixNano() / int64(trafficBucket)
+	i := epoch % trafficBuckets
+	if t.epochs[i] != epoch {
+		t.epochs[i], t.counts[i] = epoch, 0
+	}
+	t.counts[i]++
+}
+
+// since sums the counts of the buckets from epoch on.
+func (t *shardTraffic) since(epoch int64) int64 {
+	var n int64
+	for i, e := range t.epochs {
+		if e >= epoch {
+			n += int64(t.counts[i])
+		}
+	}
+	return n
+}
+
+// recordTrafficLocked counts a handle request for shard id. l.mu must be
+// held.
+func (l *Litebeam) recordTrafficLocked(id int) {
+	t, ok := l.traffic[id]
+	if !ok {
+		t = &shardTraffic{}
+		l.traffic[id] = t
+	}
+	t.add(time.Now())
+}
+
+// ShardTraffic is a shard's share of handle requests, as reported by
+// HotShards.
+type ShardTraffic struct {
+	ShardID int
+	// Requests is how many times the shard's handles were requested with
+	// GetShard or AcquireShard, including by litebeam's own fan-outs,
+	// within the window.
+	Requests int64
+	// Ratio is Requests over the median across all shards, taken as at
+	// least 1.
+	Ratio float64
+}
+
+// HotShards returns the shards whose handles were requested more than
+// factor times as often as the median shard over the last window, busiest
+// first. window is rounded up to whole minutes and capped at an hour.
+func (l *Litebeam) HotShards(window time.Duration, factor float64) []ShardTraffic {
+	minutes := min(max(int64((window+trafficBucket-1)/trafficBucket), 1), trafficBuckets)
+	from := time.Now().UnixNano()/int64(trafficBucket) - minutes + 1
+
+	counts := make([]int64, l.Config.TotalShards)
+	l.mu.Lock()
+	for id, t := range l.traffic {
+		counts[id-1] = t.since(from)
+	}
+	l.mu.Unlock()
+
+	sorted := slices.Sorted(slices.Values(counts))
+	median := float64(sorted[len(sorted)/2])
+	if len(sorted)%2 == 0 {
+		median = float64(sorted[len(sorted)/2-1]+sorted[len(sorted)/2]) / 2
+	}
+	median = max(median, 1)
+
+	var hot []ShardTraffic
+	for i, n := range counts {
+		if ratio := float64(n) / median; ratio > factor {
+			hot = append(hot, ShardTraffic{ShardID: i + 1, Requests: n, Ratio: ratio})
+		}
+	}
+	slices.SortFunc(hot, func(a, b ShardTraffic) int {
+		if a.Requests != b.Requests {
+			return int(b.Requests - a.Requests)
+		}
+		return a.ShardID - b.ShardID
+	})
+	return hot
+}
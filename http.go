@@ -0,0 +1,162 @@
+package litebeam
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Handler returns an http.Handler serving probes for Kubernetes and the
+// like:
+//
+//   - GET /healthz answers 200 while the Litebeam is open and 503 once it
+//     is closed, without touching any shard.
+//   - GET /readyz pings every open shard and answers 200 if all of them
+//     answer and 503 otherwise, with the result as a Health in JSON. Add
+//     ?quick=1 to quick check them as well.
+//
+// NewLitebeam only returns once startup is done, so the Litebeam is ready
+// from then on. /readyz leaves closed shards closed, so it neither opens
+// shards nor reorders the handle cache when MaxOpenShards is set; use
+// HealthCheck to check every shard. Quarantined shards are listed with
+// their reason but do not fail /readyz, as the other shards stay in
+// service.
+func (l *Litebeam) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", l.serveHealthz)
+	mux.HandleFunc("GET /readyz", l.serveReadyz)
+	return mux
+}
+
+func (l *Litebeam) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	if l.isClosed() {
+		http.Error(w, ErrClosed.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+func (l *Litebeam) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	if l.isClosed() {
+		http.Error(w, ErrClosed.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	h := l.readiness(r.Context(), r.URL.Query().Get("quick") == "1")
+	w.Header().Set("Content-Type", "application/json")
+	if !h.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(h)
+}
+
+// readiness pings, and quick checks if asked, every open shard without
+// opening closed ones or touching the handle cache. Healthy is true when
+// every open shard passed; quarantined shards carry their reason as
+// Error but do not count against it.
+func (l *Litebeam) readiness(ctx context.Context, quick bool) *Health {
+	h := &Health{
+		CheckedAt: time.Now().UTC(),
+		Healthy:   true,
+		Shards:    make([]ShardHealth, l.Config.TotalShards),
+	}
+	l.mu.Lock()
+	for _, id := range l.shardIDs() {
+		sh := &h.Shards[id-1]
+		sh.ShardID, sh.Status = id, l.statusLocked(id)
+		if sh.Status == StatusQuarantined {
+			sh.Error = l.quarantined[id].Error()
+		}
+	}
+	l.mu.Unlock()
+
+	for i := range h.Shards {
+		sh := &h.Shards[i]
+		if sh.Status != StatusOpen {
+			continue
+		}
+		s, release, ok := l.leaseOpen(sh.ShardID)
+		if !ok || s == nil {
+			// Closed, quarantined or moved since the status was read.
+			continue
+		}
+		err := pingShard(ctx, s)
+		if err == nil {
+			sh.Reachable = true
+			if quick {
+				if err = checkDB(ctx, s.NextReader(), "quick_check"); err == nil {
+					sh.QuickChecked = true
+				}
+			}
+		}
+		release()
+		if err != nil {
+			sh.Error = err.Error()
+			h.Healthy = false
+		}
+	}
+	return h
+}
+
+func (l *Litebeam) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+//go:embed status.html
+var statusHTML string
+
+var statusPage = template.Must(template.New("status").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+}).Parse(statusHTML))
+
+// StatusHandler returns an http.Handler serving a read-only HTML page
+// with the Stats of every shard and volume and the most recent lifecycle
+// events, newest first. It takes a fresh Stats snapshot per request, so
+// mount it somewhere only operators reach.
+func (l *Litebeam) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats, err := l.Stats(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		events := l.RecentEvents()
+		slices.Reverse(events)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = statusPage.Execute(w, struct {
+			Stats  *Stats
+			Events []Event
+		}{stats, events})
+		if err != nil {
+			l.Config.logger().Error("failed to render status page", "err", err)
+		}
+	})
+}
+
+// formatBytes formats an int64 or uint64 byte count with a binary unit.
+func formatBytes(n any) string {
+	var v float64
+	switch n := n.(type) {
+	case int64:
+		v = float64(n)
+	case uint64:
+		v = float64(n)
+	}
+	const units = "KMGTPE"
+	if v < 1024 {
+		return fmt.Sprintf("%.0f B", v)
+	}
+	i := -1
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", v, units[i])
+}
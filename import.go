@@ -0,0 +1,184 @@
+package litebeam
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ImportOptions controls ImportDatabase.
+type ImportOptions struct {
+	// Partition returns the key a row is assigned by, as passed to
+	// AssignToShard, given its table and its values keyed by column.
+	// Rows that belong together, such as a tenant's, must return the same
+	// key.
+	Partition func(table string, row map[string]any) (string, error)
+	// Tables lists the tables to import, in order. Defaults to every table
+	// of the source, in creation order.
+	Tables []string
+	// BatchSize is how many rows are written to a shard per transaction.
+	// Defaults to 1000.
+	BatchSize int
+}
+
+// ImportDatabase splits the single SQLite database at srcPath across the
+// shards, assigning every row of every table with opts.Partition. The
+// tables must already exist in the shards, for example through Migrations
+// or InitSchemaFunc. It returns how many rows were written to each shard,
+// which on error covers the rows committed before it. The source is only
+// read.
+func (l *Litebeam) ImportDatabase(ctx context.Context, srcPath string, opts ImportOptions) (map[int]int64, error) {
+	if err := l.writable(); err != nil {
+		return nil, err
+	}
+	if opts.Partition == nil {
+		return nil, errors.New("ImportOptions.Partition is required")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+
+	src, err := openFile(srcPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	tables := opts.Tables
+	if tables == nil {
+		if tables, err = sourceTables(ctx, src); err != nil {
+			return nil, fmt.Errorf("error listing tables: %v", err)
+		}
+	}
+
+	counts := map[int]int64{}
+	for _, table := range tables {
+		if err := l.importTable(ctx, src, table, opts, counts); err != nil {
+			return counts, fmt.Errorf("error importing %s: %v", table, err)
+		}
+	}
+	return counts, nil
+}
+
+// importTable copies every row of table into the shard opts.Partition
+// assigns it to, adding the rows written to counts.
+func (l *Litebeam) importTable(ctx context.Context, src *sql.DB, table string, opts ImportOptions, counts map[int]int64) error {
+	rows, err := src.QueryContext(ctx, "SELECT * FROM "+quoteIdent(table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	quoted := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = quoteIdent(c)
+	}
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		quoteIdent(table), strings.Join(quoted, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", "))
+
+	pending := map[int][][]any{}
+	flush := func(id int) error {
+		batch := pending[id]
+		delete(pending, id)
+		if err := l.insertBatch(ctx, id, stmt, batch); err != nil {
+			return fmt.Errorf("shard %d: %w", id, err)
+		}
+		counts[id] += int64(len(batch))
+		return nil
+	}
+
+	for rows.Next() {
+		values := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		row := make(map[string]any, len(cols))
+		for i, c := range cols {
+			row[c] = values[i]
+		}
+
+		base, err := opts.Partition(table, row)
+		if err != nil {
+			return err
+		}
+		id, err := l.AssignToShard(base)
+		if err != nil {
+			return err
+		}
+		pending[id] = append(pending[id], values)
+		if len(pending[id]) >= opts.BatchSize {
+			if err := flush(id); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range l.shardIDs() {
+		if len(pending[id]) > 0 {
+			if err := flush(id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// insertBatch runs stmt once for every row of batch on shard id, in one
+// transaction.
+func (l *Litebeam) insertBatch(ctx context.Context, id int, stmt string, batch [][]any) error {
+	return l.withShard(id, func(s *Shard) error {
+		tx, err := s.Writer.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		insert, err := tx.PrepareContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+		defer insert.Close()
+		for _, values := range batch {
+			if _, err := insert.ExecContext(ctx, values...); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// sourceTables returns the tables of db in creation order, leaving out
+// SQLite's and litebeam's own.
+func sourceTables(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT name FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+			AND name NOT IN ('schema_migrations', 'shard_labels')
+		ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
@@ -0,0 +1,112 @@
+package litebeam
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QueryLatencyBuckets are the upper bounds of the latency histogram kept
+// for every shard when Config.InstrumentQueries is set.
+var QueryLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	25 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	2500 * time.Millisecond,
+}
+
+// QueryStats counts the statements run on one shard.
+type QueryStats struct {
+	Count  uint64 `json:"count"`
+	Errors uint64 `json:"errors"`
+	// Time is the total time spent running statements.
+	Time time.Duration `json:"time_ns"`
+	// Buckets holds, for each of QueryLatencyBuckets, the number of
+	// statements that took at most that long.
+	Buckets []uint64 `json:"buckets"`
+}
+
+// queryStats holds the QueryStats of every shard that has run a statement.
+type queryStats struct {
+	mu     sync.Mutex
+	shards map[int]*shardQueries
+}
+
+type shardQueries struct {
+	count   atomic.Uint64
+	errors  atomic.Uint64
+	nanos   atomic.Int64
+	buckets []atomic.Uint64
+}
+
+func newQueryStats() *queryStats {
+	return &queryStats{shards: map[int]*shardQueries{}}
+}
+
+func (q *queryStats) shard(id int) *shardQueries {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, ok := q.shards[id]
+	if !ok {
+		s = &shardQueries{buckets: make([]atomic.Uint64, len(QueryLatencyBuckets))}
+		q.shards[id] = s
+	}
+	return s
+}
+
+func (q *queryStats) record(id int, d time.Duration, err error) {
+	s := q.shard(id)
+	s.count.Add(1)
+	s.nanos.Add(int64(d))
+	if err != nil {
+		s.errors.Add(1)
+	}
+	for i, le := range QueryLatencyBuckets {
+		if d <= le {
+			s.buckets[i].Add(1)
+		}
+	}
+}
+
+// snapshot returns the QueryStats of every shard keyed by shard ID.
+func (q *queryStats) snapshot() map[int]QueryStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	m := make(map[int]QueryStats, len(q.shards))
+	for id, s := range q.shards {
+		stats := QueryStats{
+			Count:   s.count.Load(),
+			Errors:  s.errors.Load(),
+			Time:    time.Duration(s.nanos.Load()),
+			Buckets: make([]uint64, len(s.buckets)),
+		}
+		for i := range s.buckets {
+			stats.Buckets[i] = s.buckets[i].Load()
+		}
+		m[id] = stats
+	}
+	return m
+}
+
+// instrumentQueries is the innermost middleware when InstrumentQueries is
+// set. It times every statement into the shard's QueryStats and the
+// MetricsSink.
+func (c *Config) instrumentQueries(next QueryHandler) QueryHandler {
+	return func(ctx context.Context, q Query) error {
+		start := time.Now()
+		err := next(ctx, q)
+		d := time.Since(start)
+
+		c.queries.record(q.ShardID, d, err)
+		sink := c.sink()
+		sink.Timing("query", q.ShardID, d)
+		sink.Counter("queries", q.ShardID, 1)
+		if err != nil {
+			sink.Counter("query.errors", q.ShardID, 1)
+		}
+		return err
+	}
+}
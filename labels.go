@@ -0,0 +1,196 @@
+package litebeam
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// ErrNoMatchingShards is returned when no shard matches a label selector.
+var ErrNoMatchingShards = errors.New("no shards match the label selector")
+
+// Labels are stored in each shard, so they move with the shard file.
+const createLabelsTable = `
+CREATE TABLE IF NOT EXISTS shard_labels (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);`
+
+// SetShardLabels replaces the labels of shard id, such as region or tier.
+func (l *Litebeam) SetShardLabels(ctx context.Context, id int, labels map[string]string) error {
+	return l.withShard(id, func(s *Shard) error {
+		if s.readOnly {
+			return ErrReadOnly
+		}
+		tx, err := s.Writer.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.ExecContext(ctx, createLabelsTable); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM shard_labels"); err != nil {
+			return err
+		}
+		for k, v := range labels {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO shard_labels (key, value) VALUES (?, ?)", k, v); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// GetShardLabels returns the labels of shard id. A shard without labels
+// returns an empty map.
+func (l *Litebeam) GetShardLabels(ctx context.Context, id int) (map[string]string, error) {
+	var labels map[string]string
+	err := l.withShard(id, func(s *Shard) error {
+		var err error
+		labels, err = readLabels(ctx, s.Reader)
+		return err
+	})
+	return labels, err
+}
+
+// ShardsWithLabels returns, in ID order, the shards whose labels include
+// every key and value in selector. An empty selector matches every shard.
+// Quarantined shards are left out.
+func (l *Litebeam) ShardsWithLabels(ctx context.Context, selector map[string]string) ([]int, error) {
+	return l.shardsMatching(ctx, l.activeShardIDs(), selector)
+}
+
+// shardsMatching returns, in ID order, the shards among ids whose labels
+// match selector. Quarantined shards cannot be acquired, so their labels
+// are read from the file directly.
+func (l *Litebeam) shardsMatching(ctx context.Context, ids []int, selector map[string]string) ([]int, error) {
+	var (
+		mu      sync.Mutex
+		matched = map[int]bool{}
+		active  []int
+		errs    = map[int]error{}
+	)
+	for _, id := range ids {
+		if !l.isQuarantined(id) {
+			active = append(active, id)
+			continue
+		}
+		labels, err := l.readLabelsFile(ctx, id)
+		errs[id] = err
+		matched[id] = err == nil && matchLabels(labels, selector)
+	}
+	for id, err := range l.fanOut(ctx, active, 1, func(ctx context.Context, id int, s *Shard) error {
+		labels, err := readLabels(ctx, s.Reader)
+		if err != nil {
+			return err
+		}
+		if matchLabels(labels, selector) {
+			mu.Lock()
+			matched[id] = true
+			mu.Unlock()
+		}
+		return nil
+	}) {
+		errs[id] = err
+	}
+
+	var result []int
+	for _, id := range ids {
+		if err := errs[id]; err != nil {
+			return nil, fmt.Errorf("error reading labels of shard %d: %v", id, err)
+		}
+		if matched[id] {
+			result = append(result, id)
+		}
+	}
+	return result, nil
+}
+
+// readLabelsFile reads the labels of shard id from its file, without
+// opening the shard.
+func (l *Litebeam) readLabelsFile(ctx context.Context, id int) (map[string]string, error) {
+	key, err := shardKey(l.Config.KeyProvider, id)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openFile(l.Config.shardPath(id), key)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return readLabels(ctx, db)
+}
+
+// AssignToShardWithLabels maps base to one of the shards whose labels match
+// selector, for example to keep an item in region=eu. Quarantined shards
+// still count, so the mapping does not change while a shard is out of
+// service; if base maps to one, ErrShardQuarantined is returned along with
+// its ID. It reads the labels of every shard; callers assigning many items
+// should call ShardsWithLabels once and use AssignAmong.
+func (l *Litebeam) AssignToShardWithLabels(ctx context.Context, base string, selector map[string]string) (int, error) {
+	ids, err := l.shardsMatching(ctx, l.shardIDs(), selector)
+	if err != nil {
+		return 0, err
+	}
+	return l.AssignAmong(base, ids)
+}
+
+// AssignAmong maps base to one of the given shard IDs. The result depends
+// on the set of IDs, so the same set must be used to find the item again:
+// relabelling shards moves the items placed this way. Like AssignToShard,
+// it returns ErrShardQuarantined along with the ID if base maps to a
+// quarantined shard.
+func (l *Litebeam) AssignAmong(base string, ids []int) (int, error) {
+	if len(ids) == 0 {
+		return 0, ErrNoMatchingShards
+	}
+	ids = slices.Sorted(slices.Values(ids))
+	idx, err := hashIndex(base, len(ids))
+	if err != nil {
+		return 0, err
+	}
+	id := ids[idx]
+	l.counters.assignments.Add(1)
+	l.Config.sink().Counter("assignments", id, 1)
+	if l.isQuarantined(id) {
+		return id, fmt.Errorf("shard %d: %w", id, ErrShardQuarantined)
+	}
+	return id, nil
+}
+
+func readLabels(ctx context.Context, db *sql.DB) (map[string]string, error) {
+	labels := map[string]string{}
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'shard_labels'").Scan(&exists)
+	if err != nil || !exists {
+		return labels, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT key, value FROM shard_labels")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		labels[k] = v
+	}
+	return labels, rows.Err()
+}
+
+func matchLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
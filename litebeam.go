@@ -1,91 +1,627 @@
 package litebeam
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
 	"math/big"
 	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	_ "github.com/ncruces/go-sqlite3/driver"
+	"github.com/ncruces/go-sqlite3"
+	"github.com/ncruces/go-sqlite3/driver"
 
 	_ "github.com/ncruces/go-sqlite3/embed"
 )
 
 const (
-	dbFilePattern = "shard_%d.db"
+	dbFilePattern    = "shard_%d.db"
+	defaultCacheSize = 1000000000
 )
 
 type Litebeam struct {
 	Config *Config
+	// Shards holds the currently open shards keyed by shard ID. Prefer
+	// GetShard, which opens shards on demand and is safe for concurrent use.
 	Shards map[int]*Shard
+
+	mu     sync.Mutex
+	closed bool
+	lru    *shardLRU
+	// moving holds the shards being moved by MoveShardToTier.
+	moving map[int]bool
+	// opening holds the shards being opened by getShardLocked, with a
+	// channel closed once the attempt is over.
+	opening map[int]chan struct{}
+	// current holds the shards known to be at MinSchemaVersion.
+	current map[int]bool
+	// quarantined holds the quarantined shards and why.
+	quarantined map[int]error
+	// traffic counts handle requests per shard for HotShards.
+	traffic  map[int]*shardTraffic
+	counters counters
+	// failures holds the last failure HealthCheck saw on each shard.
+	failures map[int]shardFailure
+	// walOver holds the shards whose WAL was over WALSizeThreshold at the
+	// last check. Only the WAL check task uses it.
+	walOver map[int]bool
+	// pending holds the callbacks to run once l.mu is released.
+	pending []func()
+	// released is closed and replaced whenever a lease is released, to
+	// wake fanOut workers waiting for room to open a shard.
+	released chan struct{}
+	subs     subscriptions
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
 }
 
 type Config struct {
 	BasePath       string
 	TotalShards    int
 	InitSchemaFunc func(db *sql.DB) error
+	// InitShardFunc is called with the shard's writer every time a shard is
+	// opened, after InitSchemaFunc. Unlike InitSchemaFunc it gets a context
+	// bounded by InitTimeout and can vary the schema by shard.
+	InitShardFunc func(ctx context.Context, info ShardInfo, db *sql.DB) error
+	// SeedFunc is called once for every newly created shard, after its
+	// schema is set up, to insert reference or configuration rows. If it
+	// fails the new shard file is removed, so it is retried on next open.
+	SeedFunc func(ctx context.Context, info ShardInfo, db *sql.DB) error
+	// InitTimeout bounds each InitShardFunc and SeedFunc call. Zero means
+	// no timeout.
+	InitTimeout time.Duration
+
+	// ConsistencyPolicy decides what NewLitebeam does when the shard files
+	// on disk do not match TotalShards. Defaults to ConsistencyWarn.
+	ConsistencyPolicy ConsistencyPolicy
+
+	// MaxOpenShards caps how many shards are kept open at once. When set,
+	// shards are opened on demand by GetShard and idle shards are closed,
+	// least recently used first, to stay under the cap. Zero opens every
+	// shard at startup and never closes them.
+	MaxOpenShards int
+	// ConnBudget caps the total number of open connections across all
+	// shards, to stay clear of the process file-descriptor limit. It is
+	// checked, like MaxOpenShards, whenever GetShard opens a shard, and
+	// also makes shards open on demand. Zero means no budget.
+	ConnBudget int
+	// ShardIdleTTL closes shards that have not been used or leased for this
+	// long. They are reopened by the next GetShard. Setting it makes shards
+	// open on demand. Zero keeps shards open.
+	ShardIdleTTL time.Duration
+
+	// Pools tunes the writer and reader pools of every shard.
+	Pools ShardPoolConfig
+	// ShardPools overrides Pools for individual shard IDs. Only non-zero
+	// fields of an override are applied.
+	ShardPools map[int]ShardPoolConfig
+	// ReaderPools is the number of reader pools opened per shard, each
+	// tuned by Pools.Reader. Use Shard.NextReader to spread reads across
+	// them. Defaults to 1.
+	ReaderPools int
+
+	// Retry controls how busy and locked errors are retried when opening
+	// and initializing shards, and by Litebeam.Retry.
+	Retry RetryPolicy
+
+	// ReadOnly opens every shard with mode=ro and skips InitSchemaFunc,
+	// for example for a standby process reading the files of another.
+	// Shard files must already exist, and methods that would change them,
+	// such as Migrate, RestoreShard or CleanOrphans, return ErrReadOnly.
+	ReadOnly bool
+	// DSNParams are added to every shard's connection string, after the
+	// defaults. Use "_pragma" entries to run extra PRAGMAs per connection.
+	DSNParams url.Values
+	// ImmutableShards lists shards, such as archived ones, that are opened
+	// with mode=ro&immutable=1 so SQLite skips locking. Their files must not
+	// change while open, and their WAL must be checkpointed beforehand as
+	// immutable databases ignore it.
+	ImmutableShards []int
+	// ConnectHook is called for every new connection to a shard, before it
+	// is handed to database/sql. Use it to run PRAGMAs, register functions
+	// or load extensions that the DSN cannot express.
+	ConnectHook func(shardID int, conn *sqlite3.Conn) error
+	// SlowQueryThreshold, if set, logs every statement that takes at least
+	// this long to run, at warn level, with its shard, SQL, a digest of
+	// the SQL for grouping, and its duration. Exec calls without arguments
+	// run through sqlite3_exec and are not traced. It uses the connection's
+	// trace callback, which a ConnectHook calling Conn.Trace replaces.
+	SlowQueryThreshold time.Duration
+	// Middleware wraps every statement run on a shard's pools, the first
+	// entry outermost, including statements run through the *sql.DB
+	// directly. It sees each Exec and the start of each Query, but not
+	// transaction control.
+	Middleware []Middleware
+	// InstrumentQueries times every statement run on a shard's pools,
+	// including through the *sql.DB directly, into a per-shard latency
+	// histogram and error count reported by Metrics, and into the
+	// MetricsSink.
+	InstrumentQueries bool
+
+	// CheckpointInterval runs PRAGMA wal_checkpoint(TRUNCATE) on every open
+	// shard with no connection in use at this interval. Zero disables it.
+	CheckpointInterval time.Duration
+	// WALSizeThreshold, checked every WALCheckInterval, is the size in
+	// bytes above which a shard's -wal file is reported: logged at warn
+	// level, counted on the MetricsSink as "wal.over_threshold" and
+	// delivered as EventWALOverThreshold, once each time it crosses the
+	// threshold. With WALCheckpoint set, an open shard over the threshold
+	// is checkpointed with TRUNCATE right away.
+	WALSizeThreshold int64
+	WALCheckInterval time.Duration
+	WALCheckpoint    bool
+	// OptimizeInterval runs PRAGMA optimize on every shard at this
+	// interval, within MaintenanceWindow, opening closed shards in turn.
+	// Zero disables it.
+	OptimizeInterval time.Duration
+	// OptimizeAnalyze runs a full ANALYZE instead of PRAGMA optimize.
+	OptimizeAnalyze bool
+	// MaintenanceWindow limits when heavier maintenance tasks run.
+	MaintenanceWindow MaintenanceWindow
+
+	// AutoVacuum sets auto_vacuum on new shard files. Existing files keep
+	// their mode until they are VACUUMed.
+	AutoVacuum AutoVacuumMode
+	// VacuumInterval runs PRAGMA incremental_vacuum at this interval, within
+	// MaintenanceWindow, on every shard in incremental mode whose freelist
+	// exceeds VacuumFreelistThreshold pages, opening closed shards in turn.
+	// Zero disables it.
+	VacuumInterval          time.Duration
+	VacuumFreelistThreshold int
+
+	// CacheSize is the per-connection page cache, using SQLite's
+	// cache_size semantics: positive values are pages, negative values are
+	// KiB. Defaults to 1000000000 pages, which effectively never evicts.
+	CacheSize int
+	// MmapSize is the maximum number of bytes of each shard to memory-map.
+	// Zero leaves memory-mapped I/O off. SQLite clamps it to the build's
+	// limit, and the embedded WASM build does not memory-map at all.
+	MmapSize int64
+	// PageSize sets the page size of new shard files. Existing files keep
+	// their page size.
+	PageSize int
+
+	// WarmupStatements are prepared on every connection opened by Warmup.
+	WarmupStatements []string
+	// WarmupBytes is how much of each shard file Warmup reads to prime the
+	// OS page cache. Zero skips reading.
+	WarmupBytes int64
+
+	// Migrations are the versioned schema changes applied by Migrate. Shard
+	// files created on open are migrated to the latest version right away.
+	Migrations []Migration
+	// SchemaFS holds numbered .sql migration files at its root, read with
+	// MigrationsFromFS and added to Migrations. Use fs.Sub for a
+	// subdirectory of an embed.FS.
+	SchemaFS fs.FS
+	// SchemaTemplateShard, when set, is the shard whose live schema is
+	// copied into every newly created shard file, before InitSchemaFunc and
+	// Migrations run. It is skipped while the template has no file yet.
+	SchemaTemplateShard int
+	// MigrationLockStale is how long a migration lock file may go without
+	// being refreshed before another process takes it over, e.g. after a
+	// crash. Defaults to 5 minutes. It is only used on platforms without
+	// flock, where the OS does not drop the lock of a crashed process.
+	MigrationLockStale time.Duration
+	// MinSchemaVersion, if set, makes AssignToShard refuse shards whose
+	// schema version is below it with ErrSchemaStale, so new items do not
+	// land on shards that have not been migrated yet during a rollout.
+	MinSchemaVersion int
+	// ShardPathFunc, if set, names shard files instead of the default
+	// shard_<id>.db. Relative paths are taken relative to BasePath and may
+	// include subdirectories, which are created as needed. It must return a
+	// distinct, stable path for every shard ID.
+	ShardPathFunc func(shardID int) string
+	// FanOutDirs spreads shard files over 256 subdirectories of BasePath
+	// named by two hex digits of a hash of the file name, such as
+	// BasePath/3f/shard_123.db, for filesystems that slow down with many
+	// files in one directory. Changing it for existing data moves every
+	// shard path, so it must be set before the first shard is created.
+	FanOutDirs bool
+	// BasePaths lists further directories, such as other disks, that shard
+	// files may live in besides BasePath. A shard is opened from whichever
+	// base path holds its file; new shard files are placed by Placement.
+	// Other files, like the migration lock, stay in BasePath.
+	BasePaths []string
+	Placement PlacementPolicy
+	// Tiers names further directories, such as cheap storage for old
+	// shards, keyed by tier name. Shard files are found there like in
+	// BasePaths, but new shards are never placed in a tier; they are moved
+	// there with MoveShardToTier.
+	Tiers map[string]string
+	// BackupInterval, if set along with BackupDir, writes a backup set
+	// with BackupAll into a new timestamped directory of BackupDir every
+	// interval, then prunes old sets by BackupRetention.
+	BackupInterval  time.Duration
+	BackupDir       string
+	BackupRetention BackupRetention
+	// MirrorPath, if set along with MirrorInterval, keeps a copy of every
+	// shard in a second directory, such as another disk. Every interval,
+	// shards modified since their last copy are copied there with VACUUM
+	// INTO, so the mirror lags by up to one interval. A shard found corrupt
+	// on open is replaced by its mirror copy if that passes quick_check.
+	MirrorPath     string
+	MirrorInterval time.Duration
+	// KeyProvider, if set, encrypts every shard file with the key it
+	// returns for the shard, using the driver's adiantum VFS. Backups and
+	// mirror copies are encrypted with the same key.
+	KeyProvider KeyProvider
+	// AutoQuarantine quarantines every shard that PingAll,
+	// IntegrityCheckAll or QuickCheckAll find corrupt, so requests fail
+	// fast with ErrShardQuarantined instead of hitting the damaged file.
+	AutoQuarantine bool
+	// OnQuarantine, if set, is called with the reason whenever a shard is
+	// quarantined.
+	OnQuarantine func(shardID int, reason error)
+	// OnShardCreated, if set, is called whenever a shard's file is
+	// created, including by NewLitebeam before it returns.
+	OnShardCreated func(info ShardInfo)
+	// OnShardRestored, if set, is called whenever a shard's file has been
+	// replaced from the backup at src, by RestoreShard, RestoreAll or
+	// AutoRestore, for example to drop cached data of the shard.
+	OnShardRestored func(shardID int, src string)
+	// EventBuffer is the number of events each Subscribe channel holds
+	// before further events are dropped. Defaults to 64.
+	EventBuffer int
+	// AutoRestore, with AutoQuarantine and BackupDir set, restores each
+	// shard quarantined as corrupt from the newest scheduled backup set
+	// whose copy of it passes integrity_check, and puts it back in service.
+	// Writes made since that backup are lost. Every restore is logged.
+	AutoRestore bool
+
+	// Logger receives everything litebeam logs: errors from background
+	// tasks, warnings about damaged or mismatched shard files, shard
+	// creation at info level and assignment decisions at debug level.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+	// Quiet discards all logging, overriding Logger.
+	Quiet bool
+	// MetricsSink, if set, receives metrics as they happen.
+	MetricsSink MetricsSink
+	// ExpvarName, if set, publishes Metrics as an expvar under this name,
+	// such as "litebeam", until Close. Each open Litebeam needs its own
+	// name.
+	ExpvarName string
+
+	// queries holds the per-shard statement counts when InstrumentQueries
+	// is set.
+	queries *queryStats
+	// placements records where shards were created when BasePaths or
+	// Tiers is set.
+	placements *placementLog
+}
+
+// ShardInfo describes a shard to hooks and reports.
+type ShardInfo struct {
+	ID   int
+	Path string
+	// Created is true when the shard's file did not exist before it was
+	// opened.
+	Created bool
 }
 
 type Shard struct {
 	Writer *sql.DB
 	Reader *sql.DB
+	// Readers holds every reader pool of the shard. Reader is Readers[0].
+	Readers []*sql.DB
+
+	next     atomic.Uint32
+	readOnly bool
+	// created is true when the shard's file was new when it was opened.
+	created bool
+	// key is the shard's encryption key, nil if it is not encrypted.
+	key []byte
+
+	// Guarded by Litebeam.mu.
+	leases   int
+	lastUsed time.Time
+}
+
+// NextReader returns the shard's reader pools in round-robin order.
+func (s *Shard) NextReader() *sql.DB {
+	if len(s.Readers) == 0 {
+		return s.Reader
+	}
+	return s.Readers[int(s.next.Add(1)-1)%len(s.Readers)]
+}
+
+// idle reports whether none of the shard's connections are in use.
+func (s *Shard) idle() bool {
+	for _, db := range s.dbs() {
+		if db.Stats().InUse > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// evictable reports whether the shard can be closed without pulling it out
+// from under a caller. Litebeam.mu must be held.
+func (s *Shard) evictable() bool {
+	return s.leases == 0 && s.idle()
+}
+
+// dbs returns every pool owned by the shard, writer first.
+func (s *Shard) dbs() []*sql.DB {
+	return append([]*sql.DB{s.Writer}, s.Readers...)
 }
 
 func NewLitebeam(c Config) (*Litebeam, error) {
-	conf := c.validateConfig()
-	s, err := NewShards(conf)
+	conf, err := c.validateConfig()
 	if err != nil {
 		return nil, err
 	}
+	if err := conf.loadMigrations(); err != nil {
+		return nil, err
+	}
+	if err := applyConsistencyPolicy(conf); err != nil {
+		return nil, err
+	}
 
-	return &Litebeam{
-		Config: conf,
-		Shards: s,
-	}, nil
+	var s map[int]*Shard
+	start := time.Now()
+	if conf.lazy() {
+		if err := conf.makeBasePaths(); err != nil {
+			return nil, err
+		}
+		s = map[int]*Shard{}
+	} else {
+		var err error
+		s, err = NewShards(conf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	l := &Litebeam{
+		Config:      conf,
+		Shards:      s,
+		lru:         newShardLRU(),
+		current:     map[int]bool{},
+		moving:      map[int]bool{},
+		opening:     map[int]chan struct{}{},
+		quarantined: map[int]error{},
+		traffic:     map[int]*shardTraffic{},
+		failures:    map[int]shardFailure{},
+		walOver:     map[int]bool{},
+		released:    make(chan struct{}),
+	}
+	for id, shard := range s {
+		l.recordOpen(id, shard, nil, 0)
+	}
+	l.counters.openNanos.Add(int64(time.Since(start)))
+	if conf.ExpvarName != "" {
+		if err := publishExpvar(conf.ExpvarName, l); err != nil {
+			closeShards(s)
+			return nil, err
+		}
+	}
+	for _, id := range l.shardIDs() {
+		if shard, ok := s[id]; ok && shard.created {
+			l.shardCreated(id)
+		}
+	}
+	l.startMaintenance()
+	return l, nil
 }
 
 func NewShards(c *Config) (map[int]*Shard, error) {
 	shards := map[int]*Shard{}
-	var openDbs []*sql.DB
 
+	if err := c.makeBasePaths(); err != nil {
+		return nil, err
+	}
+
+	// Open the schema template first so new shards can be cloned from it.
+	order := make([]int, 0, c.TotalShards)
+	if t := c.SchemaTemplateShard; t >= 1 && t <= c.TotalShards {
+		order = append(order, t)
+	}
 	for i := 0; i < c.TotalShards; i++ {
-		val := i + 1
-		dbPath := c.BasePath + fmt.Sprintf(dbFilePattern, val)
-		u := createDSN(dbPath)
+		if val := i + 1; val != c.SchemaTemplateShard {
+			order = append(order, val)
+		}
+	}
 
-		db, err := sql.Open("sqlite3", u)
+	for _, val := range order {
+		s, err := openShard(c, val)
 		if err != nil {
-			closeAll(openDbs)
-			return nil, fmt.Errorf("error generating writer for shard %d: %v", val, err)
+			closeShards(shards)
+			return nil, err
+		}
+		shards[val] = s
+	}
+
+	return shards, nil
+}
+
+// openShard opens the writer and reader pools for a single shard, creating
+// and initializing the file if needed. A corrupt shard is replaced by its
+// mirror copy when MirrorPath has a good one.
+func openShard(c *Config, val int) (*Shard, error) {
+	s, err := openShardFile(c, val)
+	if errors.Is(err, ErrShardCorrupt) && c.failoverToMirror(val) {
+		return openShardFile(c, val)
+	}
+	return s, err
+}
+
+func openShardFile(c *Config, val int) (*Shard, error) {
+	var openDbs []*sql.DB
+	dbPath := c.shardPath(val)
+	readOnly := c.ReadOnly || c.isImmutable(val)
+	key, err := shardKey(c.KeyProvider, val)
+	if err != nil {
+		return nil, err
+	}
+	u := createDSN(c, val, dbPath, key)
+
+	_, placed := c.placements.dir(c, val)
+	exists, err := validateShardFile(val, dbPath, readOnly || placed, key != nil)
+	if err != nil {
+		return nil, err
+	}
+	created := !exists
+	if created {
+		if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+			return nil, fmt.Errorf("error creating shard directory: %v", err)
 		}
-		openDbs = append(openDbs, db)
-		db.SetMaxOpenConns(1)
+	}
 
-		if c.InitSchemaFunc != nil {
-			err = c.InitSchemaFunc(db)
-			if err != nil {
-				closeAll(openDbs)
-				return nil, fmt.Errorf("error initializing database: %v", err)
+	db, err := openDB(c, val, u)
+	if err != nil {
+		return nil, fmt.Errorf("error generating writer for shard %d: %v", val, err)
+	}
+	openDbs = append(openDbs, db)
+	pools := c.poolsFor(val)
+	pools.Writer.apply(db)
+
+	// Ping so the file exists on disk even if nothing writes to it yet.
+	ctx := context.Background()
+	if err = c.Retry.do(ctx, db.Ping); err != nil {
+		closeAll(openDbs)
+		if errors.Is(err, sqlite3.NOTADB) || errors.Is(err, sqlite3.CORRUPT) {
+			err = fmt.Errorf("%w: %v", ErrShardCorrupt, err)
+		}
+		return nil, &ShardError{ID: val, Path: dbPath, Err: err}
+	}
+
+	info := ShardInfo{ID: val, Path: dbPath, Created: created}
+	if !readOnly {
+		if err = setupShard(ctx, c, info, db); err != nil {
+			closeAll(openDbs)
+			if created {
+				// Start over on the next open, so steps that only run for
+				// new shards are not skipped.
+				_ = removeDBFiles(dbPath)
 			}
+			return nil, err
 		}
+	}
 
-		rdb, err := sql.Open("sqlite3", u)
+	var readers []*sql.DB
+	for range max(c.ReaderPools, 1) {
+		rdb, err := openDB(c, val, u)
 		if err != nil {
 			closeAll(openDbs)
 			return nil, fmt.Errorf("error generating reader for shard %d: %v", val, err)
 		}
 		openDbs = append(openDbs, rdb)
+		pools.Reader.apply(rdb)
+		readers = append(readers, rdb)
+	}
+	if created {
+		c.logger().Info("created shard", "shard", val, "path", dbPath)
+		if err := c.placements.record(c, val, dbPath); err != nil {
+			c.logger().Error("failed to record shard placement", "shard", val, "err", err)
+		}
+	}
+
+	return &Shard{
+		Writer:   db,
+		Reader:   readers[0],
+		Readers:  readers,
+		readOnly: readOnly,
+		created:  created,
+		key:      key,
+	}, nil
+}
 
-		s := Shard{
-			Writer: db,
-			Reader: rdb,
+// openDB opens a pool for shard val, setting up slow query logging and
+// running Config.ConnectHook on every new connection, with statements
+// routed through Config.Middleware and the query instrumentation.
+func openDB(c *Config, val int, dsn string) (*sql.DB, error) {
+	var hook func(*sqlite3.Conn) error
+	if c.ConnectHook != nil || c.SlowQueryThreshold > 0 {
+		hook = func(conn *sqlite3.Conn) error {
+			if c.SlowQueryThreshold > 0 {
+				if err := c.traceSlowQueries(val, conn); err != nil {
+					return err
+				}
+			}
+			if c.ConnectHook != nil {
+				return c.ConnectHook(val, conn)
+			}
+			return nil
 		}
-		shards[val] = &s
 	}
+	mws := c.Middleware
+	if c.InstrumentQueries {
+		mws = append(slices.Clip(mws), c.instrumentQueries)
+	}
+	if len(mws) > 0 {
+		return openInterceptedDB(val, dsn, hook, mws)
+	}
+	return driver.Open(dsn, hook)
+}
 
-	return shards, nil
+// setupShard brings a freshly opened shard's schema and data up to date:
+// new shards are cloned from the template, every shard runs the init hooks,
+// and new shards are then migrated and seeded.
+func setupShard(ctx context.Context, c *Config, info ShardInfo, db *sql.DB) error {
+	val := info.ID
+	if info.Created && c.SchemaTemplateShard > 0 && c.SchemaTemplateShard != val {
+		key, err := shardKey(c.KeyProvider, c.SchemaTemplateShard)
+		if err != nil {
+			return err
+		}
+		if err := cloneSchema(ctx, db, c.shardPath(c.SchemaTemplateShard), key); err != nil {
+			return fmt.Errorf("error cloning schema into shard %d: %v", val, err)
+		}
+	}
+
+	if c.InitSchemaFunc != nil {
+		err := c.Retry.do(ctx, func() error { return c.InitSchemaFunc(db) })
+		if err != nil {
+			return fmt.Errorf("error initializing database: %v", err)
+		}
+	}
+
+	if c.InitShardFunc != nil {
+		err := c.Retry.do(ctx, func() error {
+			return c.withInitTimeout(ctx, func(ctx context.Context) error {
+				return c.InitShardFunc(ctx, info, db)
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("error initializing shard %d: %v", val, err)
+		}
+	}
+
+	if !info.Created {
+		return nil
+	}
+
+	if len(c.Migrations) > 0 {
+		r := MigrationResult{ShardID: val}
+		if err := migrateShard(ctx, db, c.Migrations, &r); err != nil {
+			return fmt.Errorf("error migrating new shard %d: %v", val, err)
+		}
+	}
+
+	if c.SeedFunc != nil {
+		err := c.withInitTimeout(ctx, func(ctx context.Context) error {
+			return c.SeedFunc(ctx, info, db)
+		})
+		if err != nil {
+			return fmt.Errorf("error seeding shard %d: %v", val, err)
+		}
+	}
+	return nil
 }
 
 func closeAll(dbs []*sql.DB) {
@@ -94,7 +630,39 @@ func closeAll(dbs []*sql.DB) {
 	}
 }
 
+func closeShards(shards map[int]*Shard) {
+	for _, s := range shards {
+		closeAll(s.dbs())
+	}
+}
+
+// AssignToShard maps base to a shard ID. When MinSchemaVersion is set and
+// that shard is behind it, the ID is returned along with ErrSchemaStale.
+// When the shard is quarantined, the ID is returned along with
+// ErrShardQuarantined.
 func (l *Litebeam) AssignToShard(base string) (int, error) {
+	idx, err := hashIndex(base, l.Config.TotalShards)
+	if err != nil {
+		return 0, err
+	}
+	id := idx + 1
+	l.counters.assignments.Add(1)
+	l.Config.sink().Counter("assignments", id, 1)
+	// Keys can be user data, so only the shard is logged.
+	l.Config.logger().Debug("assigned to shard", "shard", id)
+	if l.isQuarantined(id) {
+		return id, fmt.Errorf("shard %d: %w", id, ErrShardQuarantined)
+	}
+	if l.Config.MinSchemaVersion > 0 {
+		if err := l.checkSchemaVersion(id); err != nil {
+			return id, err
+		}
+	}
+	return id, nil
+}
+
+// hashIndex maps base to an index in [0, n).
+func hashIndex(base string, n int) (int, error) {
 	hash := sha256.Sum256([]byte(base))
 	hashHex := hex.EncodeToString(hash[:])
 
@@ -104,39 +672,200 @@ func (l *Litebeam) AssignToShard(base string) (int, error) {
 		return 0, fmt.Errorf("failed to convert hash to integer")
 	}
 
-	mod := new(big.Int).Mod(bigIntHash, big.NewInt(int64(l.Config.TotalShards)))
-	return int(mod.Int64()) + 1, nil
+	mod := new(big.Int).Mod(bigIntHash, big.NewInt(int64(n)))
+	return int(mod.Int64()), nil
 }
 
+// Close checkpoints and closes every open shard. All errors encountered are
+// returned joined together.
 func (l *Litebeam) Close() error {
-	var firstErr error
+	l.stopMaintenance()
+	l.closeSubscriptions()
+	if l.Config.ExpvarName != "" {
+		unpublishExpvar(l.Config.ExpvarName, l)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Shards opened from now on are closed by their openers.
+	l.closed = true
+	l.waitAllOpeningLocked()
+
+	var errs []error
 	for i, shard := range l.Shards {
-		if err := shard.Writer.Close(); err != nil && firstErr == nil {
-			firstErr = fmt.Errorf("failed to close writer for shard %d: %w", i, err)
+		if err := closeShard(i, shard); err != nil {
+			errs = append(errs, err)
 		}
-		if err := shard.Reader.Close(); err != nil && firstErr == nil {
-			firstErr = fmt.Errorf("failed to close reader for shard %d: %w", i, err)
+		delete(l.Shards, i)
+		l.lru.remove(i)
+	}
+	return errors.Join(errs...)
+}
+
+// closeShard truncates the shard's WAL and closes its reader pools and then
+// its writer.
+func closeShard(id int, s *Shard) error {
+	var errs []error
+	if !s.readOnly {
+		if _, err := s.Writer.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			errs = append(errs, fmt.Errorf("failed to checkpoint shard %d: %w", id, err))
 		}
 	}
-	return firstErr
+	for _, r := range s.Readers {
+		if err := r.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close reader for shard %d: %w", id, err))
+		}
+	}
+	if err := s.Writer.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close writer for shard %d: %w", id, err))
+	}
+	return errors.Join(errs...)
 }
 
-func (c *Config) validateConfig() *Config {
+func (c *Config) validateConfig() (*Config, error) {
+	if c.BasePath == "" {
+		return nil, errors.New("BasePath is empty")
+	}
 	if c.BasePath[len(c.BasePath)-1] != '/' {
 		c.BasePath = c.BasePath + "/"
 	}
+	c.BasePaths = slices.Clone(c.BasePaths)
+	for i, p := range c.BasePaths {
+		if p == "" {
+			return nil, fmt.Errorf("BasePaths[%d] is empty", i)
+		}
+		if p[len(p)-1] != '/' {
+			c.BasePaths[i] = p + "/"
+		}
+	}
+	if c.MirrorPath != "" && c.MirrorPath[len(c.MirrorPath)-1] != '/' {
+		c.MirrorPath = c.MirrorPath + "/"
+	}
+	c.Tiers = maps.Clone(c.Tiers)
+	for name, p := range c.Tiers {
+		if p == "" {
+			return nil, fmt.Errorf("tier %q has an empty path", name)
+		}
+		if p[len(p)-1] != '/' {
+			c.Tiers[name] = p + "/"
+		}
+	}
+	if c.InstrumentQueries {
+		c.queries = newQueryStats()
+	}
+	c.placements = c.newPlacementLog()
+	switch {
+	case c.Quiet:
+		c.Logger = slog.New(slog.DiscardHandler)
+	case c.Logger == nil:
+		c.Logger = slog.Default().With("logger", "litebeam")
+	}
+
+	return c, nil
+}
+
+// withInitTimeout calls fn with ctx bounded by InitTimeout.
+func (c *Config) withInitTimeout(ctx context.Context, fn func(ctx context.Context) error) error {
+	if c.InitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.InitTimeout)
+		defer cancel()
+	}
+	return fn(ctx)
+}
+
+// shardPath returns the path of shard id's database file.
+func (c *Config) shardPath(id int) string {
+	name := c.shardName(id)
+	if filepath.IsAbs(name) {
+		return name
+	}
+	if len(c.BasePaths) > 0 || len(c.Tiers) > 0 {
+		return c.locate(id, name)
+	}
+	return c.BasePath + name
+}
+
+// shardName returns shard id's file name relative to its base path, or an
+// absolute path from ShardPathFunc.
+func (c *Config) shardName(id int) string {
+	name := fmt.Sprintf(dbFilePattern, id)
+	if c.ShardPathFunc != nil {
+		name = c.ShardPathFunc(id)
+		if filepath.IsAbs(name) {
+			return name
+		}
+	}
+	if c.FanOutDirs {
+		name = fanOutDir(name) + "/" + name
+	}
+	return name
+}
 
-	return c
+// fanOutDir returns the subdirectory for a shard file name under
+// FanOutDirs.
+func fanOutDir(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:1])
+}
+
+// lazy reports whether shards are opened on demand rather than at startup.
+func (c *Config) lazy() bool {
+	return c.MaxOpenShards > 0 || c.ConnBudget > 0 || c.ShardIdleTTL > 0
+}
+
+// logger returns Logger, or the default logger if it is not set.
+func (c *Config) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return slog.Default()
 }
 
-func createDSN(dbPath string) string {
+func (c *Config) isImmutable(id int) bool {
+	return slices.Contains(c.ImmutableShards, id)
+}
+
+// createDSN builds the connection string for a shard file. Settings are
+// passed as _pragma parameters, which the driver runs on every new
+// connection.
+func createDSN(c *Config, val int, dbPath string, key []byte) string {
 	//Create connection URL
 	connectionUrlParams := make(url.Values)
-	connectionUrlParams.Add("_txlock", "immediate")
-	connectionUrlParams.Add("_journal_mode", "WAL")
-	connectionUrlParams.Add("_busy_timeout", "5000")
-	connectionUrlParams.Add("_synchronous", "NORMAL")
-	connectionUrlParams.Add("_cache_size", "1000000000")
-	connectionUrlParams.Add("_foreign_keys", "true")
-	return fmt.Sprintf("file:%s?", dbPath) + connectionUrlParams.Encode()
+	// The key must be known before the file is first read.
+	addKey(connectionUrlParams, key)
+	connectionUrlParams.Add("_pragma", "busy_timeout(5000)")
+	if c.isImmutable(val) {
+		connectionUrlParams.Add("immutable", "1")
+	}
+	// page_size and auto_vacuum only take effect before the first table is
+	// created.
+	if c.PageSize > 0 {
+		connectionUrlParams.Add("_pragma", fmt.Sprintf("page_size(%d)", c.PageSize))
+	}
+	if c.AutoVacuum != "" {
+		connectionUrlParams.Add("_pragma", fmt.Sprintf("auto_vacuum(%s)", c.AutoVacuum))
+	}
+	if c.ReadOnly || c.isImmutable(val) {
+		connectionUrlParams.Add("mode", "ro")
+	} else {
+		connectionUrlParams.Add("_txlock", "immediate")
+		connectionUrlParams.Add("_pragma", "journal_mode(WAL)")
+	}
+	connectionUrlParams.Add("_pragma", "synchronous(NORMAL)")
+	cacheSize := c.CacheSize
+	if cacheSize == 0 {
+		cacheSize = defaultCacheSize
+	}
+	connectionUrlParams.Add("_pragma", fmt.Sprintf("cache_size(%d)", cacheSize))
+	if c.MmapSize > 0 {
+		connectionUrlParams.Add("_pragma", fmt.Sprintf("mmap_size(%d)", c.MmapSize))
+	}
+	connectionUrlParams.Add("_pragma", "foreign_keys(true)")
+	for k, vs := range c.DSNParams {
+		for _, v := range vs {
+			connectionUrlParams.Add(k, v)
+		}
+	}
+	return fileURI(dbPath, connectionUrlParams)
 }
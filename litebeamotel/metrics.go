@@ -0,0 +1,135 @@
+// Package litebeamotel exports the metrics of a litebeam.Litebeam through
+// OpenTelemetry.
+//
+// RegisterMetrics observes Litebeam.Metrics, including the per-shard
+// statement counts kept with Config.InstrumentQueries. OpenTelemetry has
+// no asynchronous histograms, so the statement latency histogram is not
+// among them; add QueryMiddleware to Config.Middleware to record it.
+package litebeamotel
+
+import (
+	"context"
+	"time"
+
+	"github.com/hfalzon/litebeam"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/hfalzon/litebeam"
+
+// RegisterMetrics registers asynchronous instruments for l's metrics with
+// a meter from mp. Every collection takes a fresh snapshot with
+// Litebeam.Metrics. Call Unregister on the result before closing l.
+func RegisterMetrics(l *litebeam.Litebeam, mp metric.MeterProvider) (metric.Registration, error) {
+	meter := mp.Meter(meterName)
+
+	var (
+		shards, openShards, openConns, quarantined, fileSize metric.Int64ObservableGauge
+		pools, shardConns, volumeSize, volumeUsage           metric.Int64ObservableGauge
+		assignments, opens, created, openErrors              metric.Int64ObservableCounter
+		queries, queryErrors                                 metric.Int64ObservableCounter
+		openTime                                             metric.Float64ObservableCounter
+		err                                                  error
+	)
+	gauge := func(g *metric.Int64ObservableGauge, name, desc, unit string) {
+		if err == nil {
+			*g, err = meter.Int64ObservableGauge(name, metric.WithDescription(desc), metric.WithUnit(unit))
+		}
+	}
+	counter := func(c *metric.Int64ObservableCounter, name, desc string) {
+		if err == nil {
+			*c, err = meter.Int64ObservableCounter(name, metric.WithDescription(desc))
+		}
+	}
+	gauge(&shards, "litebeam.shards", "Number of configured shards.", "{shard}")
+	gauge(&openShards, "litebeam.shards.open", "Number of open shards.", "{shard}")
+	gauge(&openConns, "litebeam.connections.open", "Number of open connections across all shards.", "{connection}")
+	gauge(&quarantined, "litebeam.shards.quarantined", "Number of quarantined shards.", "{shard}")
+	gauge(&fileSize, "litebeam.shard.file.size", "Size of a shard's file plus its WAL.", "By")
+	gauge(&pools, "litebeam.shard.pools", "Number of connection pools open on a shard.", "{pool}")
+	gauge(&shardConns, "litebeam.shard.connections", "Number of connections open on a shard, by state.", "{connection}")
+	gauge(&volumeSize, "litebeam.volume.size", "Size of the filesystem under a shard directory.", "By")
+	gauge(&volumeUsage, "litebeam.volume.usage", "Space on the filesystem under a shard directory, by state.", "By")
+	counter(&assignments, "litebeam.assignments", "Number of items assigned to shards.")
+	counter(&opens, "litebeam.shard.opens", "Number of shards opened.")
+	counter(&created, "litebeam.shards.created", "Number of shard files created.")
+	counter(&openErrors, "litebeam.shard.open_errors", "Number of failed shard opens.")
+	counter(&queries, "litebeam.shard.queries", "Number of statements run on a shard.")
+	counter(&queryErrors, "litebeam.shard.query_errors", "Number of statements run on a shard that failed.")
+	if err == nil {
+		openTime, err = meter.Float64ObservableCounter("litebeam.shard.open.time",
+			metric.WithDescription("Time spent opening and creating shards."), metric.WithUnit("s"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		m := l.Metrics()
+		o.ObserveInt64(shards, int64(m.TotalShards))
+		o.ObserveInt64(openShards, int64(m.OpenShards))
+		o.ObserveInt64(openConns, int64(m.OpenConns))
+		o.ObserveInt64(quarantined, int64(m.QuarantinedShards))
+		o.ObserveInt64(assignments, int64(m.Assignments))
+		o.ObserveInt64(opens, int64(m.ShardOpens))
+		o.ObserveInt64(created, int64(m.ShardsCreated))
+		o.ObserveInt64(openErrors, int64(m.OpenErrors))
+		o.ObserveFloat64(openTime, m.OpenTime.Seconds())
+		for id, size := range m.FileBytes {
+			o.ObserveInt64(fileSize, size, metric.WithAttributes(attribute.Int("shard", id)))
+		}
+		for id, h := range m.Handles {
+			shard := attribute.Int("shard", id)
+			o.ObserveInt64(pools, int64(h.Pools), metric.WithAttributes(shard))
+			o.ObserveInt64(shardConns, int64(h.InUse), metric.WithAttributes(shard, attribute.String("state", "in_use")))
+			o.ObserveInt64(shardConns, int64(h.Idle), metric.WithAttributes(shard, attribute.String("state", "idle")))
+		}
+		for id, q := range m.Queries {
+			shard := attribute.Int("shard", id)
+			o.ObserveInt64(queries, int64(q.Count), metric.WithAttributes(shard))
+			o.ObserveInt64(queryErrors, int64(q.Errors), metric.WithAttributes(shard))
+		}
+		for _, v := range m.Volumes {
+			if v.Error != "" {
+				continue
+			}
+			path := attribute.String("path", v.Path)
+			o.ObserveInt64(volumeSize, int64(v.TotalBytes), metric.WithAttributes(path))
+			o.ObserveInt64(volumeUsage, int64(v.UsedBytes), metric.WithAttributes(path, attribute.String("state", "used")))
+			o.ObserveInt64(volumeUsage, int64(v.FreeBytes), metric.WithAttributes(path, attribute.String("state", "free")))
+		}
+		return nil
+	}, shards, openShards, openConns, quarantined, fileSize, pools, shardConns, volumeSize, volumeUsage, assignments, opens, created, openErrors, queries, queryErrors, openTime)
+}
+
+// QueryMiddleware returns a litebeam.Middleware recording the duration of
+// every statement in a histogram with a meter from mp, bucketed by
+// litebeam.QueryLatencyBuckets. Add it last in Config.Middleware so it
+// times only the statement.
+func QueryMiddleware(mp metric.MeterProvider) (litebeam.Middleware, error) {
+	bounds := make([]float64, len(litebeam.QueryLatencyBuckets))
+	for i, le := range litebeam.QueryLatencyBuckets {
+		bounds[i] = le.Seconds()
+	}
+	duration, err := mp.Meter(meterName).Float64Histogram("litebeam.query.duration",
+		metric.WithDescription("Time spent running statements on a shard."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(bounds...))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next litebeam.QueryHandler) litebeam.QueryHandler {
+		return func(ctx context.Context, q litebeam.Query) error {
+			start := time.Now()
+			err := next(ctx, q)
+			attrs := []attribute.KeyValue{attribute.Int("shard", q.ShardID)}
+			if err != nil {
+				attrs = append(attrs, attribute.Bool("error", true))
+			}
+			duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+			return err
+		}
+	}, nil
+}
@@ -0,0 +1,102 @@
+package litebeamotel
+
+import (
+	"testing"
+
+	"github.com/hfalzon/litebeam"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRegisterMetrics(t *testing.T) {
+	l, err := litebeam.NewLitebeam(litebeam.Config{BasePath: t.TempDir(), TotalShards: 2, Quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.AssignToShard("item"); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := sdkmetric.NewManualReader()
+	reg, err := RegisterMetrics(l, sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Unregister()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(t.Context(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				values[m.Name] = data.DataPoints[0].Value
+			case metricdata.Gauge[int64]:
+				values[m.Name] = int64(len(data.DataPoints))
+			}
+		}
+	}
+	if values["litebeam.assignments"] != 1 || values["litebeam.shards.created"] != 2 {
+		t.Fatalf("expected 1 assignment and 2 created shards, got %v", values)
+	}
+	if values["litebeam.shard.file.size"] != 2 {
+		t.Fatalf("expected a file size per shard, got %v", values)
+	}
+}
+
+func TestQueryMiddleware(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	mw, err := QueryMiddleware(mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := litebeam.NewLitebeam(litebeam.Config{
+		BasePath:          t.TempDir(),
+		TotalShards:       2,
+		Quiet:             true,
+		InstrumentQueries: true,
+		Middleware:        []litebeam.Middleware{mw},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s, err := l.GetShard(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	reg, err := RegisterMetrics(l, mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Unregister()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(t.Context(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	var histogram, counted bool
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Histogram[float64]:
+				histogram = m.Name == "litebeam.query.duration" && len(data.DataPoints) > 0
+			case metricdata.Sum[int64]:
+				if m.Name == "litebeam.shard.queries" {
+					counted = len(data.DataPoints) > 0
+				}
+			}
+		}
+	}
+	if !histogram || !counted {
+		t.Fatalf("expected the query histogram and counts, got histogram %v, counts %v", histogram, counted)
+	}
+}
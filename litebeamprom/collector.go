@@ -0,0 +1,96 @@
+// Package litebeamprom exports the metrics of a litebeam.Litebeam to
+// Prometheus.
+package litebeamprom
+
+import (
+	"strconv"
+
+	"github.com/hfalzon/litebeam"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	shardsDesc      = prometheus.NewDesc("litebeam_shards", "Number of configured shards.", nil, nil)
+	openShardsDesc  = prometheus.NewDesc("litebeam_open_shards", "Number of open shards.", nil, nil)
+	openConnsDesc   = prometheus.NewDesc("litebeam_open_connections", "Number of open connections across all shards.", nil, nil)
+	quarantinedDesc = prometheus.NewDesc("litebeam_quarantined_shards", "Number of quarantined shards.", nil, nil)
+	assignmentsDesc = prometheus.NewDesc("litebeam_assignments_total", "Number of items assigned to shards.", nil, nil)
+	opensDesc       = prometheus.NewDesc("litebeam_shard_opens_total", "Number of shards opened.", nil, nil)
+	createdDesc     = prometheus.NewDesc("litebeam_shards_created_total", "Number of shard files created.", nil, nil)
+	openErrorsDesc  = prometheus.NewDesc("litebeam_shard_open_errors_total", "Number of failed shard opens.", nil, nil)
+	openTimeDesc    = prometheus.NewDesc("litebeam_shard_open_seconds_total", "Time spent opening and creating shards.", nil, nil)
+	fileBytesDesc   = prometheus.NewDesc("litebeam_shard_file_bytes", "Size of a shard's file plus its WAL.", []string{"shard"}, nil)
+	poolsDesc       = prometheus.NewDesc("litebeam_shard_pools", "Number of connection pools open on a shard.", []string{"shard"}, nil)
+	shardConnsDesc  = prometheus.NewDesc("litebeam_shard_connections", "Number of connections open on a shard, by state.", []string{"shard", "state"}, nil)
+	volumeSizeDesc  = prometheus.NewDesc("litebeam_volume_size_bytes", "Size of the filesystem under a shard directory.", []string{"path"}, nil)
+	volumeBytesDesc = prometheus.NewDesc("litebeam_volume_bytes", "Space on the filesystem under a shard directory, by state.", []string{"path", "state"}, nil)
+	queryTimeDesc   = prometheus.NewDesc("litebeam_query_duration_seconds", "Time taken by statements run on a shard.", []string{"shard"}, nil)
+	queryErrorsDesc = prometheus.NewDesc("litebeam_query_errors_total", "Number of statements run on a shard that failed.", []string{"shard"}, nil)
+)
+
+type collector struct {
+	l *litebeam.Litebeam
+}
+
+// NewCollector returns a collector of l's metrics. Every scrape takes a
+// fresh snapshot with Litebeam.Metrics.
+func NewCollector(l *litebeam.Litebeam) prometheus.Collector {
+	return collector{l: l}
+}
+
+func (c collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		shardsDesc, openShardsDesc, openConnsDesc, quarantinedDesc,
+		assignmentsDesc, opensDesc, createdDesc, openErrorsDesc, openTimeDesc,
+		fileBytesDesc, poolsDesc, shardConnsDesc, volumeSizeDesc, volumeBytesDesc,
+		queryTimeDesc, queryErrorsDesc,
+	} {
+		ch <- d
+	}
+}
+
+func (c collector) Collect(ch chan<- prometheus.Metric) {
+	m := c.l.Metrics()
+	gauge := func(d *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v, labels...)
+	}
+	counter := func(d *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v, labels...)
+	}
+
+	gauge(shardsDesc, float64(m.TotalShards))
+	gauge(openShardsDesc, float64(m.OpenShards))
+	gauge(openConnsDesc, float64(m.OpenConns))
+	gauge(quarantinedDesc, float64(m.QuarantinedShards))
+	counter(assignmentsDesc, float64(m.Assignments))
+	counter(opensDesc, float64(m.ShardOpens))
+	counter(createdDesc, float64(m.ShardsCreated))
+	counter(openErrorsDesc, float64(m.OpenErrors))
+	counter(openTimeDesc, m.OpenTime.Seconds())
+	for id, size := range m.FileBytes {
+		gauge(fileBytesDesc, float64(size), strconv.Itoa(id))
+	}
+	for id, h := range m.Handles {
+		shard := strconv.Itoa(id)
+		gauge(poolsDesc, float64(h.Pools), shard)
+		gauge(shardConnsDesc, float64(h.InUse), shard, "in_use")
+		gauge(shardConnsDesc, float64(h.Idle), shard, "idle")
+	}
+	for _, v := range m.Volumes {
+		if v.Error != "" {
+			continue
+		}
+		gauge(volumeSizeDesc, float64(v.TotalBytes), v.Path)
+		gauge(volumeBytesDesc, float64(v.UsedBytes), v.Path, "used")
+		gauge(volumeBytesDesc, float64(v.FreeBytes), v.Path, "free")
+	}
+	for id, q := range m.Queries {
+		shard := strconv.Itoa(id)
+		buckets := make(map[float64]uint64, len(q.Buckets))
+		for i, n := range q.Buckets {
+			buckets[litebeam.QueryLatencyBuckets[i].Seconds()] = n
+		}
+		ch <- prometheus.MustNewConstHistogram(queryTimeDesc, q.Count, q.Time.Seconds(), buckets, shard)
+		counter(queryErrorsDesc, float64(q.Errors), shard)
+	}
+}
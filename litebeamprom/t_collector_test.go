@@ -0,0 +1,60 @@
+package litebeamprom
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hfalzon/litebeam"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	l, err := litebeam.NewLitebeam(litebeam.Config{BasePath: t.TempDir(), TotalShards: 2, Quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.AssignToShard("item"); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCollector(l)
+	if n := testutil.CollectAndCount(c); n != 20 {
+		t.Fatalf("expected 20 metrics, got %d", n)
+	}
+	want := `
+# HELP litebeam_assignments_total Number of items assigned to shards.
+# TYPE litebeam_assignments_total counter
+litebeam_assignments_total 1
+# HELP litebeam_shards_created_total Number of shard files created.
+# TYPE litebeam_shards_created_total counter
+litebeam_shards_created_total 2
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "litebeam_assignments_total", "litebeam_shards_created_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorQueries(t *testing.T) {
+	l, err := litebeam.NewLitebeam(litebeam.Config{BasePath: t.TempDir(), TotalShards: 2, Quiet: true, InstrumentQueries: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s, err := l.GetShard(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("SELECT nothing"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	want := `
+# HELP litebeam_query_errors_total Number of statements run on a shard that failed.
+# TYPE litebeam_query_errors_total counter
+litebeam_query_errors_total{shard="2"} 1
+`
+	if err := testutil.CollectAndCompare(NewCollector(l), strings.NewReader(want), "litebeam_query_errors_total"); err != nil {
+		t.Fatal(err)
+	}
+}
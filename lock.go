@@ -0,0 +1,157 @@
+package litebeam
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	migrationLockFile         = "migrate.lock"
+	defaultMigrationLockStale = 5 * time.Minute
+	lockPollInterval          = 100 * time.Millisecond
+)
+
+// fileLock is a cross-process lock on a file. Where the OS supports it,
+// it is an advisory lock on the open file, which the OS drops when the
+// holder exits; see lock_unix.go. Elsewhere it is held by creating the
+// file with a token only the holder knows; see tokenLock.
+type fileLock struct {
+	path string
+	// f holds the OS lock.
+	f *os.File
+	// token, stop, done and stale are used by tokenLock.
+	token string
+	stop  chan struct{}
+	done  chan struct{}
+	stale time.Duration
+}
+
+// lockMigrations takes the cross-process migration lock in BasePath.
+func (l *Litebeam) lockMigrations(ctx context.Context) (*fileLock, error) {
+	return acquireFileLock(ctx, l.Config.BasePath+migrationLockFile, l.Config.MigrationLockStale)
+}
+
+// waitLock sleeps for lockPollInterval or until ctx is done.
+func waitLock(ctx context.Context, path string) error {
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for lock %s: %w", path, ctx.Err())
+	case <-time.After(lockPollInterval):
+		return nil
+	}
+}
+
+// lockOwner describes this process, for the lock file's contents.
+func lockOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("pid %d on %s at %s", os.Getpid(), host, time.Now().UTC().Format(time.RFC3339))
+}
+
+// acquireTokenLock waits until it can create path holding a fresh token,
+// or until ctx is done. The holder refreshes the file's modification time,
+// and a lock file not refreshed within stale is taken over: it is renamed
+// aside, which only one contender can do, and checked to still be the
+// stale lock before it is removed. The refresh and release only touch the
+// file while it still holds the holder's token.
+func acquireTokenLock(ctx context.Context, path string, stale time.Duration) (*fileLock, error) {
+	if stale <= 0 {
+		stale = defaultMigrationLockStale
+	}
+	var b [16]byte
+	rand.Read(b[:])
+	token := hex.EncodeToString(b[:])
+
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%s\n%s\n", token, lockOwner())
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("error writing lock file: %v", err)
+			}
+			lock := &fileLock{
+				path:  path,
+				token: token,
+				stop:  make(chan struct{}),
+				done:  make(chan struct{}),
+				stale: stale,
+			}
+			go lock.refresh()
+			return lock, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("error creating lock file: %v", err)
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > stale {
+			takeOverLock(path, token, stale)
+			continue
+		}
+		if err := waitLock(ctx, path); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// takeOverLock removes the stale lock at path. It is renamed aside first,
+// so of several processes finding it stale only one moves it; if what was
+// moved is no longer stale, another process took the lock over in the
+// meantime and it is put back.
+func takeOverLock(path, token string, stale time.Duration) {
+	aside := path + "." + token
+	if err := os.Rename(path, aside); err != nil {
+		return
+	}
+	if info, err := os.Stat(aside); err == nil && time.Since(info.ModTime()) <= stale {
+		// Link fails if yet another process has created path since.
+		_ = os.Link(aside, path)
+	}
+	_ = os.Remove(aside)
+}
+
+// lockToken returns the token written into the lock file at path.
+func lockToken(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	token, _, _ := strings.Cut(string(data), "\n")
+	return token
+}
+
+// refresh touches the lock file until release is called.
+func (l *fileLock) refresh() {
+	defer close(l.done)
+	t := time.NewTicker(l.stale / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-t.C:
+			if lockToken(l.path) == l.token {
+				_ = os.Chtimes(l.path, now, now)
+			}
+		}
+	}
+}
+
+// releaseToken removes the lock file if it still holds l's token, so a
+// holder whose lock was taken over does not remove the new holder's.
+func (l *fileLock) releaseToken() error {
+	close(l.stop)
+	<-l.done
+	if lockToken(l.path) != l.token {
+		return fmt.Errorf("lock %s was taken over by another process", l.path)
+	}
+	return os.Remove(l.path)
+}
@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || freebsd)
+
+package litebeam
+
+import (
+	"context"
+	"time"
+)
+
+// acquireFileLock waits until it holds the lock file at path, or until
+// ctx is done, using acquireTokenLock as there is no flock here.
+func acquireFileLock(ctx context.Context, path string, stale time.Duration) (*fileLock, error) {
+	return acquireTokenLock(ctx, path, stale)
+}
+
+func (l *fileLock) release() error {
+	return l.releaseToken()
+}
@@ -0,0 +1,47 @@
+//go:build linux || darwin || freebsd
+
+package litebeam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// acquireFileLock waits until it holds an exclusive flock on path, or
+// until ctx is done. The OS drops the lock when the holder exits, so there
+// is no stale lock to take over and stale is unused. The file is left in
+// place on release: removing it would let a process still waiting on the
+// old file lock it alongside one that created a new file.
+func acquireFileLock(ctx context.Context, path string, stale time.Duration) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error creating lock file: %v", err)
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) && !errors.Is(err, syscall.EINTR) {
+			f.Close()
+			return nil, fmt.Errorf("error locking %s: %v", path, err)
+		}
+		if err := waitLock(ctx, path); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(lockOwner()+"\n"), 0)
+	}
+	return &fileLock{path: path, f: f}, nil
+}
+
+func (l *fileLock) release() error {
+	// Closing the file drops the lock.
+	return l.f.Close()
+}
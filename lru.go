@@ -0,0 +1,41 @@
+package litebeam
+
+import "container/list"
+
+// shardLRU tracks shard IDs in order of use, most recent first.
+type shardLRU struct {
+	order *list.List
+	elems map[int]*list.Element
+}
+
+func newShardLRU() *shardLRU {
+	return &shardLRU{
+		order: list.New(),
+		elems: map[int]*list.Element{},
+	}
+}
+
+// touch marks id as the most recently used shard.
+func (u *shardLRU) touch(id int) {
+	if e, ok := u.elems[id]; ok {
+		u.order.MoveToFront(e)
+		return
+	}
+	u.elems[id] = u.order.PushFront(id)
+}
+
+func (u *shardLRU) remove(id int) {
+	if e, ok := u.elems[id]; ok {
+		u.order.Remove(e)
+		delete(u.elems, id)
+	}
+}
+
+// oldestFirst returns the tracked shard IDs, least recently used first.
+func (u *shardLRU) oldestFirst() []int {
+	ids := make([]int, 0, u.order.Len())
+	for e := u.order.Back(); e != nil; e = e.Prev() {
+		ids = append(ids, e.Value.(int))
+	}
+	return ids
+}
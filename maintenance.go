@@ -0,0 +1,223 @@
+package litebeam
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// every runs fn on its own goroutine each interval until Close is called.
+// A non-positive interval disables the task.
+func (l *Litebeam) every(interval time.Duration, fn func()) {
+	if interval <= 0 {
+		return
+	}
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-t.C:
+				fn()
+			}
+		}
+	}()
+}
+
+// startMaintenance schedules the background tasks enabled in Config.
+func (l *Litebeam) startMaintenance() {
+	l.stop = make(chan struct{})
+	l.every(l.Config.CheckpointInterval, l.checkpointIdle)
+	l.every(l.Config.OptimizeInterval, l.optimizeAll)
+	l.every(l.Config.VacuumInterval, l.vacuumAll)
+	l.every(l.Config.ShardIdleTTL/2, l.closeIdle)
+	if l.Config.WALSizeThreshold > 0 {
+		l.every(l.Config.WALCheckInterval, l.checkWALs)
+	}
+	if l.Config.BackupDir != "" {
+		l.every(l.Config.BackupInterval, l.backupScheduled)
+	}
+	if l.Config.MirrorPath != "" {
+		l.every(l.Config.MirrorInterval, l.mirrorAll)
+	}
+}
+
+// taskContext returns a context for a background task that is cancelled
+// once Close is called.
+func (l *Litebeam) taskContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-l.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// stopMaintenance stops all background tasks and waits for them to return.
+func (l *Litebeam) stopMaintenance() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+	l.wg.Wait()
+}
+
+// checkpointIdle truncates the WAL of every open shard that has no
+// connection in use. Closed shards were checkpointed when they closed.
+func (l *Litebeam) checkpointIdle() {
+	for id := range l.openShards() {
+		l.withOpenShard(id, func(s *Shard) {
+			if s.readOnly || !s.idle() {
+				return
+			}
+			if _, err := s.Writer.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+				l.Config.logger().Error("failed to checkpoint shard", "shard", id, "err", err)
+			}
+		})
+	}
+}
+
+// withOpenShard calls fn with shard id leased if it is open, without
+// opening it or touching its LRU position.
+func (l *Litebeam) withOpenShard(id int, fn func(s *Shard)) {
+	s, release, ok := l.leaseOpen(id)
+	if !ok {
+		return
+	}
+	defer release()
+	if s != nil {
+		fn(s)
+	}
+}
+
+// checkWALs reports every shard whose WAL has grown past
+// WALSizeThreshold since the last check, and checkpoints it if asked.
+// Only open shards can have a WAL to checkpoint.
+func (l *Litebeam) checkWALs() {
+	for _, id := range l.shardIDs() {
+		info, err := os.Stat(l.Config.shardPath(id) + "-wal")
+		over := err == nil && info.Size() > l.Config.WALSizeThreshold
+		crossed := over && !l.walOver[id]
+		l.walOver[id] = over
+		if !crossed {
+			continue
+		}
+
+		l.Config.logger().Warn("shard WAL over threshold", "shard", id, "size", info.Size(), "threshold", l.Config.WALSizeThreshold)
+		l.Config.sink().Counter("wal.over_threshold", id, 1)
+		if l.Config.WALCheckpoint {
+			l.withOpenShard(id, func(s *Shard) {
+				if s.readOnly {
+					return
+				}
+				if _, err := s.Writer.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+					l.Config.logger().Error("failed to checkpoint shard", "shard", id, "err", err)
+				}
+			})
+		}
+		l.emit(Event{Type: EventWALOverThreshold, ShardID: id, Size: info.Size()})
+	}
+}
+
+// MaintenanceWindow is a daily time range, in local time, during which
+// heavier maintenance tasks may run. Start and End are offsets from
+// midnight; a window with End before Start wraps past midnight. The zero
+// value allows tasks to run at any time.
+type MaintenanceWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Contains reports whether t falls inside the window.
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	if w.Start == w.End {
+		return true
+	}
+	y, m, d := t.Date()
+	offset := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// optimizeAll runs PRAGMA optimize, or ANALYZE when OptimizeAnalyze is
+// set, on every shard that is not quarantined while inside the
+// maintenance window, one shard at a time, opening shards on demand.
+func (l *Litebeam) optimizeAll() {
+	if !l.Config.MaintenanceWindow.Contains(time.Now()) {
+		return
+	}
+	stmt := "PRAGMA optimize"
+	if l.Config.OptimizeAnalyze {
+		stmt = "ANALYZE"
+	}
+	ctx, cancel := l.taskContext()
+	defer cancel()
+	errs := l.fanOut(ctx, l.activeShardIDs(), 1, func(ctx context.Context, id int, s *Shard) error {
+		if s.readOnly {
+			return nil
+		}
+		_, err := s.Writer.ExecContext(ctx, stmt)
+		return err
+	})
+	for id, err := range errs {
+		if err != nil {
+			l.Config.logger().Error("failed to optimize shard", "shard", id, "err", err)
+		}
+	}
+}
+
+// AutoVacuumMode is the auto_vacuum setting applied to new shard files.
+type AutoVacuumMode string
+
+const (
+	AutoVacuumNone        AutoVacuumMode = "none"
+	AutoVacuumFull        AutoVacuumMode = "full"
+	AutoVacuumIncremental AutoVacuumMode = "incremental"
+)
+
+// vacuumAll runs PRAGMA incremental_vacuum on every shard that is not
+// quarantined, in incremental auto_vacuum mode and whose freelist is
+// larger than VacuumFreelistThreshold pages, while inside the maintenance
+// window, one shard at a time, opening shards on demand.
+func (l *Litebeam) vacuumAll() {
+	if !l.Config.MaintenanceWindow.Contains(time.Now()) {
+		return
+	}
+	ctx, cancel := l.taskContext()
+	defer cancel()
+	errs := l.fanOut(ctx, l.activeShardIDs(), 1, func(ctx context.Context, id int, s *Shard) error {
+		if s.readOnly {
+			return nil
+		}
+		var mode, free int
+		if err := s.Writer.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&mode); err != nil {
+			return fmt.Errorf("error reading auto_vacuum: %v", err)
+		}
+		// 2 is incremental; other modes do not support incremental_vacuum.
+		if mode != 2 {
+			return nil
+		}
+		if err := s.Writer.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&free); err != nil {
+			return fmt.Errorf("error reading freelist: %v", err)
+		}
+		if free <= l.Config.VacuumFreelistThreshold {
+			return nil
+		}
+		_, err := s.Writer.ExecContext(ctx, "PRAGMA incremental_vacuum")
+		return err
+	})
+	for id, err := range errs {
+		if err != nil {
+			l.Config.logger().Error("failed to vacuum shard", "shard", id, "err", err)
+		}
+	}
+}
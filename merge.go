@@ -0,0 +1,121 @@
+package litebeam
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ncruces/go-sqlite3/driver"
+)
+
+// ExportMerged copies tables from every shard into a single new database
+// at dstPath, for ad-hoc queries over the whole dataset. Each merged table
+// starts with a shard_id column naming the row's shard, followed by the
+// columns of the table in shard 1; constraints and indexes are not copied,
+// as keys may repeat across shards. A nil tables exports every table of
+// shard 1 except litebeam's own. Each shard is copied in one read
+// transaction, so it is consistent with itself. The database is written
+// unencrypted under a temporary name and renamed to dstPath, replacing any
+// file already there.
+func (l *Litebeam) ExportMerged(ctx context.Context, dstPath string, tables []string) error {
+	if tables == nil {
+		var err error
+		if tables, err = l.userTables(ctx, 1); err != nil {
+			return fmt.Errorf("error listing tables: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0o755); err != nil {
+		return err
+	}
+	tmp := dstPath + ".tmp"
+	if err := removeDBFiles(tmp); err != nil {
+		return err
+	}
+	defer removeDBFiles(tmp)
+
+	db, err := driver.Open(fileURI(tmp, nil))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	// ATTACH is per connection, so pin one for the whole export.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	columns := map[string][]string{}
+	errs := l.fanOut(ctx, l.shardIDs(), 1, func(ctx context.Context, id int, s *Shard) error {
+		return mergeShard(ctx, conn, id, readOnlyName(l.Config.shardPath(id), s.key), tables, columns)
+	})
+	for _, id := range l.shardIDs() {
+		if err := errs[id]; err != nil {
+			return fmt.Errorf("error merging shard %d: %v", id, err)
+		}
+	}
+
+	if err := conn.Close(); err != nil {
+		return err
+	}
+	if err := db.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dstPath)
+}
+
+// mergeShard copies tables from the shard file named src into conn's main
+// database, creating each table on first use and recording its columns in
+// columns.
+func mergeShard(ctx context.Context, conn *sql.Conn, id int, src string, tables []string, columns map[string][]string) error {
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS shard", src); err != nil {
+		return fmt.Errorf("error attaching shard: %v", err)
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE shard")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range tables {
+		t := quoteIdent(table)
+		if _, ok := columns[table]; !ok {
+			if _, err := tx.ExecContext(ctx, "CREATE TABLE main."+t+" AS SELECT 0 AS shard_id, * FROM shard."+t+" WHERE 0"); err != nil {
+				return fmt.Errorf("error creating %s: %v", table, err)
+			}
+			cols, err := tableColumns(ctx, tx, table)
+			if err != nil {
+				return err
+			}
+			columns[table] = cols[1:]
+		}
+
+		quoted := make([]string, len(columns[table]))
+		for i, c := range columns[table] {
+			quoted[i] = quoteIdent(c)
+		}
+		list := strings.Join(quoted, ", ")
+		stmt := fmt.Sprintf("INSERT INTO main.%s (shard_id, %s) SELECT ?, %s FROM shard.%s", t, list, list, t)
+		if _, err := tx.ExecContext(ctx, stmt, id); err != nil {
+			return fmt.Errorf("error copying %s: %v", table, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// userTables returns the tables of shard id, leaving out SQLite's and
+// litebeam's own.
+func (l *Litebeam) userTables(ctx context.Context, id int) ([]string, error) {
+	var tables []string
+	err := l.withShard(id, func(s *Shard) error {
+		var err error
+		tables, err = sourceTables(ctx, s.Reader)
+		return err
+	})
+	return tables, err
+}
@@ -0,0 +1,194 @@
+package litebeam
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics is a snapshot of a Litebeam's gauges and counters, for exporting
+// to a monitoring system. Counters start at zero when the Litebeam is
+// created.
+type Metrics struct {
+	TotalShards       int `json:"total_shards"`
+	OpenShards        int `json:"open_shards"`
+	OpenConns         int `json:"open_conns"`
+	QuarantinedShards int `json:"quarantined_shards"`
+
+	// Assignments counts AssignToShard and AssignAmong calls.
+	Assignments uint64 `json:"assignments"`
+	// ShardOpens counts shards opened, ShardsCreated those of them whose
+	// file was new, and OpenErrors the opens that failed.
+	ShardOpens    uint64 `json:"shard_opens"`
+	ShardsCreated uint64 `json:"shards_created"`
+	OpenErrors    uint64 `json:"open_errors"`
+	// OpenTime is the total time spent opening shards, including creating
+	// and initializing new ones.
+	OpenTime time.Duration `json:"open_time_ns"`
+
+	// FileBytes holds the size of each shard's file plus its WAL, keyed by
+	// shard ID. Shards without a file are left out.
+	FileBytes map[int]int64 `json:"file_bytes"`
+	// Handles holds the pools and connections of each open shard, keyed
+	// by shard ID, to make file descriptor leaks visible.
+	Handles map[int]ShardHandles `json:"handles"`
+	// Volumes describes the filesystem under each base path and tier
+	// directory.
+	Volumes []VolumeStats `json:"volumes"`
+	// Queries holds the statement counts and latency histogram of each
+	// shard that has run a statement, keyed by shard ID. It is only set
+	// with Config.InstrumentQueries.
+	Queries map[int]QueryStats `json:"queries,omitempty"`
+}
+
+// ShardHandles counts the open handles of one shard.
+type ShardHandles struct {
+	// Pools is the number of *sql.DB pools open on the shard: its writer
+	// and readers.
+	Pools int `json:"pools"`
+	// InUse and Idle are the open connections across those pools, from
+	// sql.DBStats.
+	InUse int `json:"in_use"`
+	Idle  int `json:"idle"`
+}
+
+// counters are the event counts reported by Metrics.
+type counters struct {
+	assignments atomic.Uint64
+	opens       atomic.Uint64
+	created     atomic.Uint64
+	openErrors  atomic.Uint64
+	openNanos   atomic.Int64
+}
+
+// recordOpen counts an attempt to open s that took d.
+func (c *counters) recordOpen(s *Shard, err error, d time.Duration) {
+	c.openNanos.Add(int64(d))
+	if err != nil {
+		c.openErrors.Add(1)
+		return
+	}
+	c.opens.Add(1)
+	if s.created {
+		c.created.Add(1)
+	}
+}
+
+// Metrics returns a snapshot of the Litebeam's metrics. It stats every
+// shard file, so it is meant to be polled, not called per request.
+func (l *Litebeam) Metrics() Metrics {
+	m := Metrics{
+		TotalShards:   l.Config.TotalShards,
+		Assignments:   l.counters.assignments.Load(),
+		ShardOpens:    l.counters.opens.Load(),
+		ShardsCreated: l.counters.created.Load(),
+		OpenErrors:    l.counters.openErrors.Load(),
+		OpenTime:      time.Duration(l.counters.openNanos.Load()),
+		FileBytes:     make(map[int]int64, l.Config.TotalShards),
+	}
+	m.OpenShards, m.OpenConns = l.OpenCounts()
+	m.Handles = l.handles()
+	m.Volumes = l.Config.volumes()
+	m.QuarantinedShards = len(l.Quarantined())
+	if l.Config.queries != nil {
+		m.Queries = l.Config.queries.snapshot()
+	}
+
+	for _, id := range l.shardIDs() {
+		if size, err := fileSize(l.Config.shardPath(id)); err == nil {
+			m.FileBytes[id] = size
+		}
+	}
+	return m
+}
+
+// handles returns the open handles of every open shard.
+func (l *Litebeam) handles() map[int]ShardHandles {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	handles := make(map[int]ShardHandles, len(l.Shards))
+	for id, s := range l.Shards {
+		var h ShardHandles
+		for _, db := range s.dbs() {
+			stats := db.Stats()
+			h.Pools++
+			h.InUse += stats.InUse
+			h.Idle += stats.Idle
+		}
+		handles[id] = h
+	}
+	return handles
+}
+
+// GetShardSize returns the on-disk size of shard id: its database file
+// plus its WAL. A shard that has no file yet has size 0.
+func (l *Litebeam) GetShardSize(id int) (int64, error) {
+	if id < 1 || id > l.Config.TotalShards {
+		return 0, fmt.Errorf("shard %d out of range 1..%d", id, l.Config.TotalShards)
+	}
+	size, err := fileSize(l.Config.shardPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	return size, err
+}
+
+// fileSize returns the size of the database file at path plus its WAL.
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	if wal, err := os.Stat(path + "-wal"); err == nil {
+		size += wal.Size()
+	}
+	return size, nil
+}
+
+var (
+	expvarMu sync.Mutex
+	// expvarLitebeams holds the Litebeam published under each expvar name.
+	// A name stays published once used, as expvar cannot remove it, and
+	// reports null while no Litebeam holds it.
+	expvarLitebeams = map[string]*Litebeam{}
+)
+
+// publishExpvar publishes l's Metrics under name.
+func publishExpvar(name string, l *Litebeam) error {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+
+	current, ok := expvarLitebeams[name]
+	switch {
+	case current != nil:
+		return fmt.Errorf("expvar %q is already in use by another Litebeam", name)
+	case !ok && expvar.Get(name) != nil:
+		return fmt.Errorf("expvar %q is already published", name)
+	case !ok:
+		expvar.Publish(name, expvar.Func(func() any {
+			expvarMu.Lock()
+			l := expvarLitebeams[name]
+			expvarMu.Unlock()
+			if l == nil {
+				return nil
+			}
+			return l.Metrics()
+		}))
+	}
+	expvarLitebeams[name] = l
+	return nil
+}
+
+// unpublishExpvar releases name for another Litebeam if l holds it.
+func unpublishExpvar(name string, l *Litebeam) {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	if expvarLitebeams[name] == l {
+		expvarLitebeams[name] = nil
+	}
+}
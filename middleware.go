@@ -0,0 +1,212 @@
+package litebeam
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+
+	"github.com/ncruces/go-sqlite3"
+	sqlite3driver "github.com/ncruces/go-sqlite3/driver"
+)
+
+// Query is a statement about to run on a shard, as seen by Middleware.
+type Query struct {
+	ShardID int
+	SQL     string
+	Args    []driver.NamedValue
+	// Exec is true for Exec calls and false for Query calls.
+	Exec bool
+}
+
+// QueryHandler runs a statement. The handler at the end of a middleware
+// chain runs it on the shard; for a Query call it only starts the query,
+// rows are read after the chain returns.
+type QueryHandler func(ctx context.Context, q Query) error
+
+// Middleware wraps a QueryHandler, like HTTP middleware, to add checks,
+// tagging, metrics or fault injection around every statement run on a
+// shard. Returning an error without calling next stops the statement and
+// the error is returned to the caller.
+type Middleware func(next QueryHandler) QueryHandler
+
+// chain returns the handler running mws around run, the first middleware
+// outermost.
+func chain(mws []Middleware, run QueryHandler) QueryHandler {
+	h := run
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// shardConnector opens connections to one shard, running the connect hook
+// on each and routing their statements through the middleware.
+type shardConnector struct {
+	driver.Connector
+	shardID     int
+	hook        func(*sqlite3.Conn) error
+	middlewares []Middleware
+}
+
+// openInterceptedDB opens a pool on dsn whose statements run through mws.
+func openInterceptedDB(shardID int, dsn string, hook func(*sqlite3.Conn) error, mws []Middleware) (*sql.DB, error) {
+	base, err := (&sqlite3driver.SQLite{}).OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(&shardConnector{
+		Connector:   base,
+		shardID:     shardID,
+		hook:        hook,
+		middlewares: mws,
+	}), nil
+}
+
+func (c *shardConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	dc, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn := dc.(sqlite3driver.Conn)
+	if c.hook != nil {
+		if err := c.hook(conn.Raw()); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return &interceptConn{Conn: conn, c: c}, nil
+}
+
+// interceptConn runs the statements of a driver connection through the
+// middleware of its connector.
+type interceptConn struct {
+	sqlite3driver.Conn
+	c *shardConnector
+}
+
+func (c *interceptConn) handle(ctx context.Context, q Query, run QueryHandler) error {
+	q.ShardID = c.c.shardID
+	return chain(c.c.middlewares, run)(ctx, q)
+}
+
+func (c *interceptConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if query == "" {
+		// Empty Execs are how driver.Savepoint reaches the connection.
+		return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	}
+	var res driver.Result
+	err := c.handle(ctx, Query{SQL: query, Args: args, Exec: true}, func(ctx context.Context, q Query) error {
+		var err error
+		res, err = c.Conn.(driver.ExecerContext).ExecContext(ctx, q.SQL, q.Args)
+		if err != driver.ErrSkip {
+			return err
+		}
+		// The driver only runs statements without arguments directly.
+		s, err := c.Conn.PrepareContext(ctx, q.SQL)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		res, err = s.(driver.StmtExecContext).ExecContext(ctx, q.Args)
+		return err
+	})
+	return res, err
+}
+
+func (c *interceptConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	var rows driver.Rows
+	err := c.handle(ctx, Query{SQL: query, Args: args}, func(ctx context.Context, q Query) error {
+		s, err := c.Conn.PrepareContext(ctx, q.SQL)
+		if err != nil {
+			return err
+		}
+		r, err := s.(driver.StmtQueryContext).QueryContext(ctx, q.Args)
+		if err != nil {
+			s.Close()
+			return err
+		}
+		rows = &stmtRows{Rows: r, stmt: s}
+		return nil
+	})
+	return rows, err
+}
+
+func (c *interceptConn) CheckNamedValue(arg *driver.NamedValue) error {
+	return c.Conn.(driver.NamedValueChecker).CheckNamedValue(arg)
+}
+
+func (c *interceptConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *interceptConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	s, err := c.Conn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &interceptStmt{Stmt: s, conn: c, query: query}, nil
+}
+
+// interceptStmt runs a statement prepared with Prepare through the
+// middleware of the connection that prepared it.
+type interceptStmt struct {
+	driver.Stmt
+	conn  *interceptConn
+	query string
+}
+
+func (s *interceptStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	var res driver.Result
+	err := s.conn.handle(ctx, Query{SQL: s.query, Args: args, Exec: true}, func(ctx context.Context, q Query) (err error) {
+		res, err = s.Stmt.(driver.StmtExecContext).ExecContext(ctx, q.Args)
+		return err
+	})
+	return res, err
+}
+
+func (s *interceptStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	var rows driver.Rows
+	err := s.conn.handle(ctx, Query{SQL: s.query, Args: args}, func(ctx context.Context, q Query) (err error) {
+		rows, err = s.Stmt.(driver.StmtQueryContext).QueryContext(ctx, q.Args)
+		return err
+	})
+	return rows, err
+}
+
+func (s *interceptStmt) CheckNamedValue(arg *driver.NamedValue) error {
+	return s.Stmt.(driver.NamedValueChecker).CheckNamedValue(arg)
+}
+
+// stmtRows closes the statement a query was prepared on with its rows,
+// passing on the column type methods of the driver's rows.
+type stmtRows struct {
+	driver.Rows
+	stmt driver.Stmt
+}
+
+func (r *stmtRows) Close() error {
+	return errors.Join(r.Rows.Close(), r.stmt.Close())
+}
+
+func (r *stmtRows) ColumnTypeDatabaseTypeName(index int) string {
+	if rows, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return rows.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *stmtRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if rows, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return rows.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *stmtRows) ColumnTypeScanType(index int) reflect.Type {
+	if rows, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return rows.ColumnTypeScanType(index)
+	}
+	return reflect.TypeFor[any]()
+}
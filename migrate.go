@@ -0,0 +1,357 @@
+package litebeam
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// ErrSchemaStale is returned by AssignToShard when the shard's schema
+// version is below MinSchemaVersion.
+var ErrSchemaStale = errors.New("shard schema is out of date")
+
+const createMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+);`
+
+// Migration is a versioned schema change applied to every shard.
+type Migration struct {
+	// Version orders migrations and must be unique and positive.
+	Version int
+	Name    string
+	// Up is the SQL that applies the migration. It may hold several
+	// statements.
+	Up string
+	// Down is the SQL that reverts the migration.
+	Down string
+}
+
+// MigrationResult is the outcome of migrating a single shard.
+type MigrationResult struct {
+	ShardID int
+	// From and To are the shard's schema versions before and after the run.
+	From int
+	To   int
+	// Pending holds the migrations newer than From, which are applied
+	// unless the run is a dry run.
+	Pending []Migration
+	Err     error
+}
+
+// MigrateOptions controls a migration run.
+type MigrateOptions struct {
+	// DryRun reports which shards are behind and what would run, without
+	// writing anything.
+	DryRun bool
+	// Concurrency is how many shards are migrated at once. Defaults to 1.
+	Concurrency int
+	// ContinueOnError keeps migrating the remaining shards after one fails.
+	// Otherwise no new shards are started after the first failure, though
+	// shards already in flight are allowed to finish.
+	ContinueOnError bool
+}
+
+// Migrate applies Config.Migrations to every shard, in version order, and
+// records each applied version in the shard's schema_migrations table.
+// Every migration runs in its own transaction. It stops at the first shard
+// that fails and returns the results so far along with that error.
+func (l *Litebeam) Migrate(ctx context.Context) ([]MigrationResult, error) {
+	return l.MigrateWithOptions(ctx, MigrateOptions{})
+}
+
+// MigrateWithOptions is Migrate with options. Unless DryRun is set, it
+// first takes a lock file in BasePath so concurrent deploys of several
+// processes do not migrate the same shards at once.
+//
+// The results are in shard ID order and cover every shard that was
+// started, so together they tell which shards reached which version. The
+// returned error joins the errors of every failed shard.
+func (l *Litebeam) MigrateWithOptions(ctx context.Context, opts MigrateOptions) ([]MigrationResult, error) {
+	migrations, err := sortMigrations(l.Config.Migrations)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.DryRun {
+		if err := l.writable(); err != nil {
+			return nil, err
+		}
+		lock, err := l.lockMigrations(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer lock.release()
+	}
+
+	var (
+		mu      sync.Mutex
+		results []MigrationResult
+	)
+	out := l.fanOutUntil(ctx, l.shardIDs(), opts.Concurrency, !opts.ContinueOnError, func(ctx context.Context, id int, s *Shard) error {
+		r := MigrationResult{ShardID: id}
+		if opts.DryRun {
+			r.Err = planShard(ctx, s.Reader, migrations, &r)
+		} else {
+			r.Err = migrateShard(ctx, s.Writer, migrations, &r)
+		}
+		mu.Lock()
+		results = append(results, r)
+		mu.Unlock()
+		return r.Err
+	})
+	// Shards that could not be opened never reached the callback.
+	for id, err := range out {
+		if err != nil && !slices.ContainsFunc(results, func(r MigrationResult) bool { return r.ShardID == id }) {
+			results = append(results, MigrationResult{ShardID: id, Err: err})
+		}
+	}
+	slices.SortFunc(results, func(a, b MigrationResult) int { return a.ShardID - b.ShardID })
+
+	var errs []error
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("failed to migrate shard %d: %w", r.ShardID, r.Err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// Rollback reverts the most recently applied migration on each of the
+// given shards, or on every shard when none are given, using its Down SQL.
+// It carries on past failing shards; each result holds that shard's error
+// and the returned error joins them all.
+func (l *Litebeam) Rollback(ctx context.Context, shardIDs ...int) ([]MigrationResult, error) {
+	if err := l.writable(); err != nil {
+		return nil, err
+	}
+	if len(shardIDs) == 0 {
+		shardIDs = l.shardIDs()
+	}
+	lock, err := l.lockMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.release()
+
+	byVersion := make(map[int]Migration, len(l.Config.Migrations))
+	for _, m := range l.Config.Migrations {
+		byVersion[m.Version] = m
+	}
+
+	var results []MigrationResult
+	var errs []error
+	for _, id := range shardIDs {
+		r := MigrationResult{ShardID: id}
+		r.Err = l.withShard(id, func(s *Shard) error {
+			return rollbackShard(ctx, s.Writer, byVersion, &r)
+		})
+		l.mu.Lock()
+		delete(l.current, id)
+		l.mu.Unlock()
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("failed to roll back shard %d: %w", id, r.Err))
+		}
+		results = append(results, r)
+	}
+	return results, errors.Join(errs...)
+}
+
+func rollbackShard(ctx context.Context, db *sql.DB, byVersion map[int]Migration, r *MigrationResult) error {
+	version, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	r.From, r.To = version, version
+	if version == 0 {
+		return nil
+	}
+
+	m, ok := byVersion[version]
+	if !ok || m.Down == "" {
+		return fmt.Errorf("no down migration for version %d", version)
+	}
+	r.Pending = []Migration{m}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+		return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", m.Version); err != nil {
+		return err
+	}
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&r.To); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// loadMigrations adds the migrations in SchemaFS to Migrations and sorts
+// them, so configuration mistakes surface at startup.
+func (c *Config) loadMigrations() error {
+	migrations := c.Migrations
+	if c.SchemaFS != nil {
+		fromFS, err := MigrationsFromFS(c.SchemaFS, ".")
+		if err != nil {
+			return err
+		}
+		migrations = slices.Concat(migrations, fromFS)
+	}
+	sorted, err := sortMigrations(migrations)
+	if err != nil {
+		return err
+	}
+	c.Migrations = sorted
+	return nil
+}
+
+// sortMigrations returns a copy of migrations in version order, checking
+// that versions are positive and unique.
+func sortMigrations(migrations []Migration) ([]Migration, error) {
+	sorted := slices.Clone(migrations)
+	slices.SortFunc(sorted, func(a, b Migration) int { return a.Version - b.Version })
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migration %q has non-positive version %d", m.Name, m.Version)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+	}
+	return sorted, nil
+}
+
+// planShard fills in r with the shard's version and the migrations newer
+// than it, without writing anything.
+func planShard(ctx context.Context, db *sql.DB, migrations []Migration, r *MigrationResult) error {
+	version, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	r.From, r.To = version, version
+	for _, m := range migrations {
+		if m.Version > version {
+			r.Pending = append(r.Pending, m)
+		}
+	}
+	return nil
+}
+
+// migrateShard applies every migration newer than the shard's version,
+// filling in r as it goes.
+func migrateShard(ctx context.Context, db *sql.DB, migrations []Migration, r *MigrationResult) error {
+	if err := planShard(ctx, db, migrations, r); err != nil {
+		return err
+	}
+	if len(r.Pending) == 0 {
+		return nil
+	}
+
+	if _, err := db.ExecContext(ctx, createMigrationsTable); err != nil {
+		return err
+	}
+	for _, m := range r.Pending {
+		if err := applyMigration(ctx, db, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		r.To = m.Version
+	}
+	return nil
+}
+
+// GetSchemaVersions returns the schema version of every shard, keyed by
+// shard ID. A shard that has never been migrated is at version 0. Shards
+// are read concurrently. Shards that cannot be read, such as quarantined
+// ones, are left out of the map and their errors are returned joined,
+// along with the versions of the others.
+func (l *Litebeam) GetSchemaVersions(ctx context.Context) (map[int]int, error) {
+	var mu sync.Mutex
+	versions := make(map[int]int, l.Config.TotalShards)
+	errs := l.fanOut(ctx, l.shardIDs(), runtime.GOMAXPROCS(0), func(ctx context.Context, id int, s *Shard) error {
+		version, err := schemaVersion(ctx, s.Reader)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		versions[id] = version
+		mu.Unlock()
+		return nil
+	})
+	var failed []error
+	for _, id := range l.shardIDs() {
+		if err := errs[id]; err != nil {
+			failed = append(failed, fmt.Errorf("error reading schema version of shard %d: %w", id, err))
+		}
+	}
+	return versions, errors.Join(failed...)
+}
+
+// checkSchemaVersion returns ErrSchemaStale if shard id is below
+// MinSchemaVersion. Shards found up to date are remembered until they are
+// rolled back, reopened or detached to be restored or moved, as those can
+// take them back to an older version.
+func (l *Litebeam) checkSchemaVersion(id int) error {
+	l.mu.Lock()
+	current := l.current[id]
+	l.mu.Unlock()
+	if current {
+		return nil
+	}
+
+	var version int
+	err := l.withShard(id, func(s *Shard) error {
+		var err error
+		version, err = schemaVersion(context.Background(), s.Reader)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if version < l.Config.MinSchemaVersion {
+		return fmt.Errorf("shard %d at version %d, want %d: %w", id, version, l.Config.MinSchemaVersion, ErrSchemaStale)
+	}
+
+	l.mu.Lock()
+	l.current[id] = true
+	l.mu.Unlock()
+	return nil
+}
+
+// schemaVersion returns the highest applied migration version, or 0 when
+// the shard has no schema_migrations table.
+func schemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&exists)
+	if err != nil || !exists {
+		return 0, err
+	}
+	var version int
+	err = db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, m Migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,79 @@
+package litebeam
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+)
+
+var (
+	// migrationFileRe matches golang-migrate file names such as
+	// 0001_create_users.up.sql.
+	migrationFileRe = regexp.MustCompile(`^([0-9]+)_(.*)\.(down|up)\.(.*)$`)
+	// plainMigrationFileRe matches numbered SQL files such as
+	// 0001_create_users.sql, which only hold the up migration.
+	plainMigrationFileRe = regexp.MustCompile(`^([0-9]+)_(.*)()\.sql$`)
+)
+
+// MigrationsFromFS reads migrations laid out the way golang-migrate expects
+// them, {version}_{title}.up.sql and {version}_{title}.down.sql, from dir in
+// fsys. It works with os.DirFS and embed.FS, so existing migrate
+// directories can be passed to Config.Migrations unchanged. Plain numbered
+// files, {version}_{title}.sql, are read as up migrations. Files that match
+// neither pattern are ignored.
+func MigrationsFromFS(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %v", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	var versions []int
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m := migrationFileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			m = plainMigrationFileRe.FindStringSubmatch(e.Name())
+		}
+		if m == nil {
+			continue
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %v", e.Name(), err)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %v", e.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+			versions = append(versions, version)
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has mismatched names %q and %q", version, mig.Name, m[2])
+		}
+
+		target := &mig.Up
+		if m[3] == "down" {
+			target = &mig.Down
+		}
+		if *target != "" {
+			return nil, fmt.Errorf("duplicate migration file %s for version %d", e.Name(), version)
+		}
+		*target = string(body)
+	}
+
+	migrations := make([]Migration, 0, len(versions))
+	for _, v := range versions {
+		migrations = append(migrations, *byVersion[v])
+	}
+	return sortMigrations(migrations)
+}
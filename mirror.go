@@ -0,0 +1,151 @@
+package litebeam
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// mirrorPath returns where shard id is mirrored under MirrorPath. Shards
+// placed at absolute paths by ShardPathFunc are mirrored under their
+// default file name, as their own names need not be unique.
+func (c *Config) mirrorPath(id int) string {
+	name := c.shardName(id)
+	if filepath.IsAbs(name) {
+		name = fmt.Sprintf(dbFilePattern, id)
+	}
+	return c.MirrorPath + name
+}
+
+// mirrorAll copies every shard changed since its last mirror copy into
+// MirrorPath. Unchanged shards and shards with no file yet are skipped
+// without being opened. Open shards are copied through their readers and
+// closed ones through a read-only connection of their own, so mirroring
+// neither opens shards in the handle cache nor counts as using them.
+// Quarantined and moving shards are skipped.
+func (l *Litebeam) mirrorAll() {
+	ctx, cancel := l.taskContext()
+	defer cancel()
+
+	for _, id := range l.shardIDs() {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := os.Stat(l.Config.shardPath(id)); err != nil || !l.Config.mirrorStale(id) {
+			continue
+		}
+		if err := l.mirrorShard(ctx, id); err != nil {
+			l.Config.logger().Error("failed to mirror shard", "shard", id, "err", err)
+		}
+	}
+}
+
+// mirrorShard copies shard id into MirrorPath and dates the copy to when
+// the copy started, so writes made while it ran still count as changes
+// the next mirrorStale must pick up.
+func (l *Litebeam) mirrorShard(ctx context.Context, id int) error {
+	s, release, ok := l.leaseOpen(id)
+	if !ok {
+		return nil
+	}
+	defer release()
+
+	key, err := shardKey(l.Config.KeyProvider, id)
+	if err != nil {
+		return err
+	}
+	var db *sql.DB
+	if s != nil {
+		db = s.NextReader()
+	} else {
+		if db, err = openFile(l.Config.shardPath(id), key); err != nil {
+			return err
+		}
+		defer db.Close()
+	}
+
+	start := time.Now()
+	dst := l.Config.mirrorPath(id)
+	if err := vacuumInto(ctx, db, key, dst); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, start, start)
+}
+
+// leaseOpen leases shard id for background work without touching its LRU
+// position, idle time or traffic. s is nil when the shard is closed, in
+// which case the file can be read directly alongside any later opener. ok
+// is false when the shard is quarantined or moving and must be left alone.
+func (l *Litebeam) leaseOpen(id int) (s *Shard, release func(), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed || l.moving[id] || l.quarantined[id] != nil {
+		return nil, nil, false
+	}
+	s = l.Shards[id]
+	if s == nil {
+		return nil, func() {}, true
+	}
+	s.leases++
+	return s, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		s.leases--
+	}, true
+}
+
+// mirrorStale reports whether shard id's file or WAL has been modified
+// since its mirror copy was started.
+func (c *Config) mirrorStale(id int) bool {
+	mirror, err := os.Stat(c.mirrorPath(id))
+	if err != nil {
+		return true
+	}
+	path := c.shardPath(id)
+	for _, p := range []string{path, path + "-wal"} {
+		if info, err := os.Stat(p); err == nil && info.ModTime().After(mirror.ModTime()) {
+			return true
+		}
+	}
+	return false
+}
+
+// failoverToMirror replaces the corrupt file of shard id with its mirror
+// copy, if there is a good one, and reports whether it did. The corrupt
+// file is kept with the .corrupt suffix.
+func (c *Config) failoverToMirror(id int) bool {
+	if c.MirrorPath == "" || c.ReadOnly {
+		return false
+	}
+	ctx := context.Background()
+	mirror, path := c.mirrorPath(id), c.shardPath(id)
+	key, err := shardKey(c.KeyProvider, id)
+	if err != nil {
+		return false
+	}
+	if err := quickCheck(ctx, mirror, key); err != nil {
+		return false
+	}
+
+	if err := os.Rename(path, path+corruptSuffix); err != nil {
+		c.logger().Error("failed to move aside corrupt shard", "shard", id, "err", err)
+		return false
+	}
+	if err := copyShardFile(ctx, mirror, path, key); err != nil {
+		c.logger().Error("failed to restore shard from mirror", "shard", id, "err", err)
+		return false
+	}
+	c.logger().Warn("corrupt shard restored from mirror", "shard", id, "mirror", mirror, "taken", mirrorTime(mirror))
+	return true
+}
+
+func mirrorTime(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "unknown time"
+	}
+	return info.ModTime().Format(time.RFC3339)
+}
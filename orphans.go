@@ -0,0 +1,66 @@
+package litebeam
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// FindOrphans returns the paths of shard files in BasePath whose ID is
+// outside 1..TotalShards. These are never routed to by AssignToShard and
+// usually come from a run with a larger TotalShards. Orphans are only
+// found with the default file naming, as names from ShardPathFunc cannot
+// be mapped back to shard IDs.
+func (l *Litebeam) FindOrphans() ([]string, error) {
+	report, err := checkConsistency(l.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	return report.Unexpected, nil
+}
+
+// CleanOrphans deletes every file returned by FindOrphans along with its
+// -wal and -shm files, and returns the removed shard paths.
+//
+// Orphans cannot be adopted: shard IDs are derived from the key hash modulo
+// TotalShards, so data in an orphan would have to be moved by the caller.
+func (l *Litebeam) CleanOrphans() ([]string, error) {
+	if err := l.writable(); err != nil {
+		return nil, err
+	}
+	paths, err := l.FindOrphans()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, path := range paths {
+		if err := removeDBFiles(path); err != nil {
+			return removed, fmt.Errorf("error removing orphan %s: %v", path, err)
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// removeDBFiles removes a database file and its WAL companions.
+func removeDBFiles(path string) error {
+	for _, p := range []string{path + "-wal", path + "-shm", path} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveDBFiles renames a database file and its WAL companions to dst, so
+// a WAL is never left to be replayed over a new file at src.
+func moveDBFiles(src, dst string) error {
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Rename(src+suffix, dst+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(src, dst)
+}
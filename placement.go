@@ -0,0 +1,246 @@
+package litebeam
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PlacementPolicy chooses which of the base paths a new shard file is
+// created in when BasePaths is set.
+type PlacementPolicy int
+
+const (
+	// PlaceRoundRobin spreads shards over the base paths by shard ID.
+	PlaceRoundRobin PlacementPolicy = iota
+	// PlaceMostFree creates each new shard on the base path with the most
+	// free space. Where free space cannot be read it falls back to
+	// PlaceRoundRobin.
+	PlaceMostFree
+)
+
+// basePaths returns BasePath followed by BasePaths.
+func (c *Config) basePaths() []string {
+	return append([]string{c.BasePath}, c.BasePaths...)
+}
+
+// searchPaths returns every directory shard files may be in: the base
+// paths followed by the tier directories in tier name order.
+func (c *Config) searchPaths() []string {
+	paths := c.basePaths()
+	for _, name := range slices.Sorted(maps.Keys(c.Tiers)) {
+		paths = append(paths, c.Tiers[name])
+	}
+	return paths
+}
+
+// makeBasePaths creates every base path and tier directory.
+func (c *Config) makeBasePaths() error {
+	for _, base := range c.searchPaths() {
+		if err := os.MkdirAll(base, 0o755); err != nil {
+			return fmt.Errorf("error creating base path: %v", err)
+		}
+	}
+	return nil
+}
+
+// locate returns the path of shard file name: the base path already
+// holding it, the one it was created in if it has gone missing, or else
+// the one the placement policy picks for it.
+func (c *Config) locate(id int, name string) string {
+	for _, dir := range c.searchPaths() {
+		if _, err := os.Stat(dir + name); err == nil {
+			return dir + name
+		}
+	}
+	// A shard created before is expected where it was placed, so a
+	// missing volume does not get it recreated empty elsewhere.
+	if dir, ok := c.placements.dir(c, id); ok {
+		return dir + name
+	}
+
+	bases := c.basePaths()
+	if c.Placement == PlaceMostFree {
+		best, bestFree := "", uint64(0)
+		for _, base := range bases {
+			_, _, free, err := diskSpace(base)
+			if err == nil && (best == "" || free > bestFree) {
+				best, bestFree = base, free
+			}
+		}
+		if best != "" {
+			return best + name
+		}
+	}
+	return bases[(id-1)%len(bases)] + name
+}
+
+// PlacementsFile is the file in BasePath recording which directory every
+// shard was created in when BasePaths or Tiers is set, one "id dir" line
+// per shard. A shard listed in it whose file is missing from every search
+// path fails to open with ErrShardMissing instead of being created again.
+const PlacementsFile = "placements"
+
+// placementLog holds the contents of PlacementsFile.
+type placementLog struct {
+	mu   sync.Mutex
+	dirs map[int]string
+}
+
+// newPlacementLog returns a placementLog when shards can be spread over
+// several directories, and nil otherwise.
+func (c *Config) newPlacementLog() *placementLog {
+	if len(c.BasePaths) == 0 && len(c.Tiers) == 0 {
+		return nil
+	}
+	return &placementLog{}
+}
+
+// dir returns the directory shard id was created in, if it is recorded.
+func (p *placementLog) dir(c *Config, id int) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.loadLocked(c); err != nil {
+		c.logger().Error("failed to read shard placements", "err", err)
+		return "", false
+	}
+	dir, ok := p.dirs[id]
+	return dir, ok
+}
+
+// record notes that shard id was created at path, in the search path
+// path starts with.
+func (p *placementLog) record(c *Config, id int, path string) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.loadLocked(c); err != nil {
+		return err
+	}
+	dir := strings.TrimSuffix(path, c.shardName(id))
+	if p.dirs[id] == dir {
+		return nil
+	}
+	if err := appendPlacement(c.BasePath+PlacementsFile, id, dir); err != nil {
+		return err
+	}
+	p.dirs[id] = dir
+	return nil
+}
+
+// forget drops shard id from PlacementsFile, so it is created again on
+// next open like a new shard.
+func (p *placementLog) forget(c *Config, id int) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.loadLocked(c); err != nil {
+		return err
+	}
+	if _, ok := p.dirs[id]; !ok {
+		return nil
+	}
+	delete(p.dirs, id)
+	return writePlacements(c.BasePath+PlacementsFile, p.dirs)
+}
+
+// loadLocked reads PlacementsFile on first use. When there is none yet,
+// it is started with the shard files already on disk, so shards created
+// before it existed are covered too. p.mu must be held.
+func (p *placementLog) loadLocked(c *Config) error {
+	if p.dirs != nil {
+		return nil
+	}
+	path := c.BasePath + PlacementsFile
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p.seedLocked(c, path)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading shard placements: %v", err)
+	}
+	defer f.Close()
+
+	dirs := map[int]string{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		idText, dir, ok := strings.Cut(sc.Text(), " ")
+		id, err := strconv.Atoi(idText)
+		if !ok || err != nil {
+			return fmt.Errorf("error reading shard placements: bad line %q", sc.Text())
+		}
+		dirs[id] = dir
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("error reading shard placements: %v", err)
+	}
+	p.dirs = dirs
+	return nil
+}
+
+func (p *placementLog) seedLocked(c *Config, path string) error {
+	dirs := map[int]string{}
+	for id := 1; id <= c.TotalShards; id++ {
+		name := c.shardName(id)
+		if filepath.IsAbs(name) {
+			continue
+		}
+		for _, dir := range c.searchPaths() {
+			if _, err := os.Stat(dir + name); err == nil {
+				dirs[id] = dir
+				break
+			}
+		}
+	}
+
+	if err := os.MkdirAll(c.BasePath, 0o755); err != nil {
+		return fmt.Errorf("error creating base path: %v", err)
+	}
+	if err := writePlacements(path, dirs); err != nil {
+		return err
+	}
+	p.dirs = dirs
+	return nil
+}
+
+// writePlacements replaces the placements file at path with dirs.
+func writePlacements(path string, dirs map[int]string) error {
+	var b strings.Builder
+	for _, id := range slices.Sorted(maps.Keys(dirs)) {
+		fmt.Fprintf(&b, "%d %s\n", id, dirs[id])
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("error writing shard placements: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing shard placements: %v", err)
+	}
+	return nil
+}
+
+func appendPlacement(path string, id int, dir string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("error writing shard placements: %v", err)
+	}
+	if _, err := fmt.Fprintf(f, "%d %s\n", id, dir); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing shard placements: %v", err)
+	}
+	return f.Close()
+}
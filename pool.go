@@ -0,0 +1,69 @@
+package litebeam
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PoolConfig tunes a database/sql connection pool. Zero fields leave the
+// pool's default in place.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// ShardPoolConfig holds the pool settings for a shard's writer and reader.
+type ShardPoolConfig struct {
+	// Writer defaults to a single open connection, as SQLite only allows
+	// one writer at a time.
+	Writer PoolConfig
+	Reader PoolConfig
+}
+
+// override returns p with every non-zero field of o applied on top.
+func (p PoolConfig) override(o PoolConfig) PoolConfig {
+	if o.MaxOpenConns != 0 {
+		p.MaxOpenConns = o.MaxOpenConns
+	}
+	if o.MaxIdleConns != 0 {
+		p.MaxIdleConns = o.MaxIdleConns
+	}
+	if o.ConnMaxLifetime != 0 {
+		p.ConnMaxLifetime = o.ConnMaxLifetime
+	}
+	if o.ConnMaxIdleTime != 0 {
+		p.ConnMaxIdleTime = o.ConnMaxIdleTime
+	}
+	return p
+}
+
+func (p PoolConfig) apply(db *sql.DB) {
+	if p.MaxOpenConns != 0 {
+		db.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime != 0 {
+		db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+	if p.ConnMaxIdleTime != 0 {
+		db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+	}
+}
+
+// poolsFor resolves the pool settings for shard id, applying any entry in
+// ShardPools on top of Pools.
+func (c *Config) poolsFor(id int) ShardPoolConfig {
+	p := ShardPoolConfig{
+		Writer: PoolConfig{MaxOpenConns: 1}.override(c.Pools.Writer),
+		Reader: c.Pools.Reader,
+	}
+	if o, ok := c.ShardPools[id]; ok {
+		p.Writer = p.Writer.override(o.Writer)
+		p.Reader = p.Reader.override(o.Reader)
+	}
+	return p
+}
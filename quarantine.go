@@ -0,0 +1,150 @@
+package litebeam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ErrShardQuarantined is returned when a quarantined shard is requested.
+var ErrShardQuarantined = errors.New("shard is quarantined")
+
+// Quarantine takes shard id out of service: it is closed if open and not
+// in use, GetShard and AssignToShard refuse it with ErrShardQuarantined,
+// and RangeShards and ShardsWithLabels skip it. Quarantine lasts until
+// Unquarantine is called or the process restarts.
+func (l *Litebeam) Quarantine(id int, reason error) error {
+	l.mu.Lock()
+	if id < 1 || id > l.Config.TotalShards {
+		l.mu.Unlock()
+		return fmt.Errorf("shard %d out of range 1..%d", id, l.Config.TotalShards)
+	}
+	if _, ok := l.quarantined[id]; ok {
+		l.mu.Unlock()
+		return nil
+	}
+	if reason == nil {
+		reason = errors.New("quarantined manually")
+	}
+	l.quarantined[id] = reason
+	l.Config.sink().Gauge("shards.quarantined", float64(len(l.quarantined)))
+	// A leased shard is left open for its current users; it can no longer
+	// be acquired and is closed once evicted or on Close.
+	if s, ok := l.Shards[id]; ok && s.leases == 0 {
+		l.closeShardLocked(id, s)
+	}
+	l.mu.Unlock()
+
+	l.Config.logger().Warn("shard quarantined", "shard", id, "reason", reason)
+	l.shardQuarantined(id, reason)
+	return nil
+}
+
+// Unquarantine puts shard id back in service, for example after its file
+// has been repaired. It is opened again on next use.
+func (l *Litebeam) Unquarantine(id int) {
+	l.mu.Lock()
+	_, ok := l.quarantined[id]
+	delete(l.quarantined, id)
+	l.Config.sink().Gauge("shards.quarantined", float64(len(l.quarantined)))
+	l.mu.Unlock()
+
+	if ok {
+		l.emit(Event{Type: EventShardUnquarantined, ShardID: id})
+	}
+}
+
+// Quarantined returns the quarantined shards and why they were
+// quarantined.
+func (l *Litebeam) Quarantined() map[int]error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return maps.Clone(l.quarantined)
+}
+
+// isQuarantined reports whether shard id is quarantined.
+func (l *Litebeam) isQuarantined(id int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.quarantined[id]
+	return ok
+}
+
+// activeShardIDs returns every shard ID that is not quarantined, in order.
+func (l *Litebeam) activeShardIDs() []int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.DeleteFunc(l.shardIDs(), func(id int) bool {
+		_, ok := l.quarantined[id]
+		return ok
+	})
+}
+
+// quarantineCorrupt quarantines the shards whose result is ErrShardCorrupt
+// when AutoQuarantine is set.
+func (l *Litebeam) quarantineCorrupt(results map[int]error) {
+	if !l.Config.AutoQuarantine {
+		return
+	}
+	for id, err := range results {
+		if errors.Is(err, ErrShardCorrupt) {
+			_ = l.Quarantine(id, err)
+			if l.Config.AutoRestore && l.Config.BackupDir != "" {
+				l.autoRestore(id)
+			}
+		}
+	}
+}
+
+// autoRestore restores quarantined shard id from the newest backup set in
+// BackupDir that holds a good copy of it, and lifts the quarantine.
+func (l *Litebeam) autoRestore(id int) {
+	ctx := context.Background()
+	src, err := l.restoreNewest(ctx, id)
+	if err != nil {
+		l.Config.logger().Error("failed to restore quarantined shard", "shard", id, "err", err)
+		return
+	}
+	l.Unquarantine(id)
+	l.Config.logger().Warn("quarantined shard restored from backup", "shard", id, "backup", src)
+}
+
+// restoreNewest restores shard id from the newest backup set in BackupDir
+// whose copy of it passes verification, and returns that set's directory.
+func (l *Litebeam) restoreNewest(ctx context.Context, id int) (string, error) {
+	sets, err := backupSets(l.Config.BackupDir)
+	if err != nil {
+		return "", err
+	}
+	scratch, err := os.MkdirTemp("", "litebeam-verify-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(scratch)
+
+	for _, set := range sets {
+		dir := filepath.Join(l.Config.BackupDir, set.time.Format(backupSetLayout))
+		manifest, err := ReadManifest(filepath.Join(dir, ManifestFile))
+		if err != nil || manifest.TotalShards != l.Config.TotalShards {
+			continue
+		}
+		i := slices.IndexFunc(manifest.Shards, func(b ShardBackup) bool { return b.ShardID == id })
+		if i < 0 || manifest.Shards[i].Error != "" {
+			continue
+		}
+		b := manifest.Shards[i]
+		if err := verifyShardBackup(ctx, dir, scratch, b, l.Config.KeyProvider, nil); err != nil {
+			l.Config.logger().Warn("skipping bad backup of shard", "shard", id, "backup", dir, "err", err)
+			continue
+		}
+		if err := l.restoreFromSet(ctx, dir, b); err != nil {
+			return "", err
+		}
+		return dir, nil
+	}
+	return "", fmt.Errorf("no good backup of shard %d in %s", id, l.Config.BackupDir)
+}
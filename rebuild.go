@@ -0,0 +1,221 @@
+package litebeam
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TableRebuild describes a table change that ALTER TABLE cannot make, such
+// as adding a constraint or changing a column type. It is applied with
+// SQLite's table-rebuild procedure: create the new table, copy the rows,
+// drop the old table, rename the new one into place and recreate the old
+// table's indexes along with the schema's views and triggers, all in one
+// transaction per shard.
+type TableRebuild struct {
+	// Table is the table to rebuild.
+	Table string
+	// Columns is the new table's column and constraint definitions, the part
+	// of CREATE TABLE between the parentheses.
+	Columns string
+	// Copy lists the columns copied from the old table. It defaults to the
+	// columns the old and new tables have in common.
+	Copy []string
+	// After holds statements run once the new table is in place, for
+	// example indexes that the change makes necessary.
+	After []string
+	// Concurrency is how many shards are rebuilt at once. Defaults to 1.
+	Concurrency int
+	// Pause is how long each worker waits after a shard, to keep the
+	// rebuild from starving normal traffic.
+	Pause time.Duration
+	// Progress, if set, is called after each shard, one call at a time.
+	Progress func(ShardProgress)
+}
+
+// ShardProgress reports one finished shard of a RebuildTable or
+// RotateKeys run.
+type ShardProgress struct {
+	ShardID int
+	// Done is how many shards have finished, including this one, out of
+	// Total.
+	Done  int
+	Total int
+	Err   error
+}
+
+// RebuildTable applies r to every shard and returns the result per shard
+// ID. A nil entry means the shard was rebuilt; a failed shard is left
+// unchanged. Read-only shards are reported with ErrReadOnly.
+func (l *Litebeam) RebuildTable(ctx context.Context, r TableRebuild) map[int]error {
+	ids := l.shardIDs()
+
+	var mu sync.Mutex
+	done := 0
+	return l.fanOut(ctx, ids, r.Concurrency, func(ctx context.Context, id int, s *Shard) error {
+		err := rebuildTable(ctx, s, r)
+
+		mu.Lock()
+		done++
+		if r.Progress != nil {
+			r.Progress(ShardProgress{ShardID: id, Done: done, Total: len(ids), Err: err})
+		}
+		mu.Unlock()
+
+		if r.Pause > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(r.Pause):
+			}
+		}
+		return err
+	})
+}
+
+func rebuildTable(ctx context.Context, s *Shard, r TableRebuild) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	// foreign_keys cannot be changed inside a transaction, so the rebuild
+	// runs on a dedicated connection with them turned off for its duration.
+	conn, err := s.Writer.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Indexes and triggers are dropped along with the old table. Views and
+	// the triggers of other tables may refer to it too, and renaming the
+	// new table fails while they point at a table that no longer exists, so
+	// they are dropped for the swap and recreated once it is in place.
+	rows, err := tx.QueryContext(ctx, `SELECT type, name, sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND (type IN ('view', 'trigger') OR (type = 'index' AND tbl_name = ?))
+		ORDER BY CASE type WHEN 'index' THEN 0 WHEN 'view' THEN 1 ELSE 2 END, rowid`, r.Table)
+	if err != nil {
+		return err
+	}
+	var drop, recreate []string
+	for rows.Next() {
+		var typ, name, stmt string
+		if err := rows.Scan(&typ, &name, &stmt); err != nil {
+			rows.Close()
+			return err
+		}
+		if typ != "index" {
+			drop = append(drop, fmt.Sprintf("DROP %s %s", strings.ToUpper(typ), quoteIdent(name)))
+		}
+		recreate = append(recreate, stmt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tmp := "_litebeam_new_" + r.Table
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(tmp), r.Columns)); err != nil {
+		return fmt.Errorf("error creating new table: %v", err)
+	}
+
+	cols := r.Copy
+	if len(cols) == 0 {
+		if cols, err = commonColumns(ctx, tx, r.Table, tmp); err != nil {
+			return err
+		}
+	}
+	quoted := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = quoteIdent(c)
+	}
+	list := strings.Join(quoted, ", ")
+
+	stmts := []string{
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", quoteIdent(tmp), list, list, quoteIdent(r.Table)),
+	}
+	stmts = append(stmts, drop...)
+	stmts = append(stmts,
+		fmt.Sprintf("DROP TABLE %s", quoteIdent(r.Table)),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", quoteIdent(tmp), quoteIdent(r.Table)),
+	)
+	stmts = append(stmts, recreate...)
+	stmts = append(stmts, r.After...)
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("error rebuilding table %s: %v", r.Table, err)
+		}
+	}
+
+	var violations int
+	if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM pragma_foreign_key_check").Scan(&violations); err != nil {
+		return err
+	}
+	if violations > 0 {
+		return fmt.Errorf("error rebuilding table %s: %d foreign key violations", r.Table, violations)
+	}
+	return tx.Commit()
+}
+
+// commonColumns returns the columns of table a that also exist in b.
+func commonColumns(ctx context.Context, tx *sql.Tx, a, b string) ([]string, error) {
+	colsA, err := tableColumns(ctx, tx, a)
+	if err != nil {
+		return nil, err
+	}
+	colsB, err := tableColumns(ctx, tx, b)
+	if err != nil {
+		return nil, err
+	}
+	var common []string
+	for _, c := range colsA {
+		if slices.Contains(colsB, c) {
+			common = append(common, c)
+		}
+	}
+	if len(common) == 0 {
+		return nil, fmt.Errorf("tables %s and %s have no columns in common", a, b)
+	}
+	return common, nil
+}
+
+func tableColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		cols = append(cols, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("table %s does not exist", table)
+	}
+	return cols, nil
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
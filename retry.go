@@ -0,0 +1,71 @@
+package litebeam
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/ncruces/go-sqlite3"
+)
+
+const (
+	defaultRetryBackoff    = 10 * time.Millisecond
+	defaultRetryMaxBackoff = time.Second
+)
+
+// RetryPolicy controls how operations are retried when SQLite reports the
+// database as busy or locked. The zero value does not retry.
+type RetryPolicy struct {
+	// Attempts is the total number of tries, including the first one.
+	Attempts int
+	// Backoff is the delay before the first retry and doubles after each
+	// attempt. Defaults to 10ms.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between attempts. Defaults to 1s.
+	MaxBackoff time.Duration
+	// Jitter randomizes each delay by up to this fraction, e.g. 0.2 for
+	// ±20%.
+	Jitter float64
+}
+
+// Retry runs fn, retrying it according to Config.Retry while it fails with
+// SQLITE_BUSY or SQLITE_LOCKED.
+func (l *Litebeam) Retry(ctx context.Context, fn func() error) error {
+	return l.Config.Retry.do(ctx, fn)
+}
+
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+	backoff := p.Backoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !isBusy(err) || attempt >= p.Attempts {
+			return err
+		}
+
+		delay := backoff
+		if p.Jitter > 0 {
+			delay += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(delay))
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// isBusy reports whether err is a SQLITE_BUSY or SQLITE_LOCKED error.
+func isBusy(err error) bool {
+	return errors.Is(err, sqlite3.BUSY) || errors.Is(err, sqlite3.LOCKED)
+}
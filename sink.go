@@ -0,0 +1,62 @@
+package litebeam
+
+import "time"
+
+// MetricsSink receives litebeam's metrics as they happen, for bridging to
+// any telemetry system. Methods are called synchronously, some with
+// internal locks held, so they must be fast and must not call back into
+// the Litebeam. shardID is 0 for metrics that are not about one shard.
+//
+// Counters are "assignments", "shard.opens", "shards.created",
+// "shard.open_errors", "events.dropped", "wal.over_threshold" and, with
+// InstrumentQueries, "queries" and "query.errors". Gauges are "shards.open",
+// "connections.open" and "shards.quarantined". Timings are "shard.open"
+// and, with InstrumentQueries, "query".
+type MetricsSink interface {
+	Counter(name string, shardID int, delta int64)
+	Gauge(name string, value float64)
+	Timing(name string, shardID int, d time.Duration)
+}
+
+// nopSink is used when Config.MetricsSink is not set.
+type nopSink struct{}
+
+func (nopSink) Counter(string, int, int64)        {}
+func (nopSink) Gauge(string, float64)             {}
+func (nopSink) Timing(string, int, time.Duration) {}
+
+func (c *Config) sink() MetricsSink {
+	if c.MetricsSink != nil {
+		return c.MetricsSink
+	}
+	return nopSink{}
+}
+
+// recordOpen counts an attempt to open shard id as s that took d, which is
+// zero for shards opened by NewLitebeam.
+func (l *Litebeam) recordOpen(id int, s *Shard, err error, d time.Duration) {
+	l.counters.recordOpen(s, err, d)
+	sink := l.Config.sink()
+	if d > 0 {
+		sink.Timing("shard.open", id, d)
+	}
+	if err != nil {
+		sink.Counter("shard.open_errors", id, 1)
+		return
+	}
+	sink.Counter("shard.opens", id, 1)
+	if s.created {
+		sink.Counter("shards.created", id, 1)
+	}
+}
+
+// reportOpenLocked sends the open shard and connection gauges to the
+// sink. l.mu must be held.
+func (l *Litebeam) reportOpenLocked() {
+	sink := l.Config.sink()
+	if _, ok := sink.(nopSink); ok {
+		return
+	}
+	sink.Gauge("shards.open", float64(len(l.Shards)))
+	sink.Gauge("connections.open", float64(l.openConnsLocked()))
+}
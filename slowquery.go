@@ -0,0 +1,36 @@
+package litebeam
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/ncruces/go-sqlite3"
+)
+
+// traceSlowQueries logs the statements on conn that take at least
+// SlowQueryThreshold.
+func (c *Config) traceSlowQueries(shardID int, conn *sqlite3.Conn) error {
+	return conn.Trace(sqlite3.TRACE_PROFILE, func(evt sqlite3.TraceEvent, arg1, arg2 any) error {
+		stmt, ok := arg1.(*sqlite3.Stmt)
+		nanos, _ := arg2.(int64)
+		if !ok || time.Duration(nanos) < c.SlowQueryThreshold {
+			return nil
+		}
+		query := stmt.SQL()
+		c.logger().Warn("slow query",
+			"shard", shardID,
+			"sql", query,
+			"digest", sqlDigest(query),
+			"duration", time.Duration(nanos))
+		return nil
+	})
+}
+
+// sqlDigest returns a short hash of query with whitespace collapsed, so
+// the same statement formatted differently groups together.
+func sqlDigest(query string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(query), " ")))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,188 @@
+package litebeam
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Shard statuses reported by Stats and HealthCheck.
+const (
+	StatusOpen        = "open"
+	StatusClosed      = "closed"
+	StatusMoving      = "moving"
+	StatusQuarantined = "quarantined"
+)
+
+// Stats is a snapshot of every shard, for dashboards.
+type Stats struct {
+	TakenAt     time.Time `json:"taken_at"`
+	TotalShards int       `json:"total_shards"`
+	// TotalRows is the sum of Rows over every shard that could be read.
+	TotalRows int64 `json:"total_rows"`
+	// TotalBytes is the sum of SizeBytes over every shard.
+	TotalBytes int64 `json:"total_bytes"`
+	// LastBackup is the time of the newest backup set in BackupDir.
+	LastBackup *time.Time   `json:"last_backup,omitempty"`
+	Shards     []ShardStats `json:"shards"`
+	// Volumes describes the filesystem under each base path and tier
+	// directory.
+	Volumes []VolumeStats `json:"volumes"`
+}
+
+// VolumeStats describes the filesystem holding one directory of shard
+// files.
+type VolumeStats struct {
+	Path       string `json:"path"`
+	TotalBytes uint64 `json:"total_bytes"`
+	UsedBytes  uint64 `json:"used_bytes"`
+	// FreeBytes is the space available to unprivileged users, which
+	// may be less than TotalBytes minus UsedBytes.
+	FreeBytes uint64 `json:"free_bytes"`
+	// Error is set when the filesystem could not be read, in which case
+	// the sizes are zero.
+	Error string `json:"error,omitempty"`
+}
+
+// ShardStats describes one shard in Stats.
+type ShardStats struct {
+	ShardID int    `json:"shard_id"`
+	Path    string `json:"path"`
+	// Status is StatusOpen, StatusClosed, StatusMoving or
+	// StatusQuarantined, as it was before Stats opened the shard.
+	Status string `json:"status"`
+	// SizeBytes is the size of the shard's file plus its WAL.
+	SizeBytes int64 `json:"size_bytes"`
+	// Rows is the number of rows across the shard's tables.
+	Rows          int64 `json:"rows"`
+	SchemaVersion int   `json:"schema_version"`
+	// LastBackup is the time of the newest backup set in BackupDir that
+	// holds this shard.
+	LastBackup *time.Time `json:"last_backup,omitempty"`
+	// Error is set when the shard could not be read, in which case Rows
+	// and SchemaVersion are zero.
+	Error string `json:"error,omitempty"`
+}
+
+// Stats returns a snapshot of every shard. It opens and counts the rows of
+// every shard that is not quarantined or moving, so it is meant for
+// dashboards polled now and then, not for every request.
+func (l *Litebeam) Stats(ctx context.Context) (*Stats, error) {
+	stats := &Stats{
+		TakenAt:     time.Now().UTC(),
+		TotalShards: l.Config.TotalShards,
+		Shards:      make([]ShardStats, l.Config.TotalShards),
+	}
+
+	var readable []int
+	l.mu.Lock()
+	for _, id := range l.shardIDs() {
+		st := &stats.Shards[id-1]
+		st.ShardID, st.Path, st.Status = id, l.Config.shardPath(id), l.statusLocked(id)
+		if st.Status == StatusOpen || st.Status == StatusClosed {
+			readable = append(readable, id)
+		}
+	}
+	l.mu.Unlock()
+
+	var mu sync.Mutex
+	errs := l.fanOut(ctx, readable, 1, func(ctx context.Context, id int, s *Shard) error {
+		rows, err := countRows(ctx, s.NextReader())
+		if err != nil {
+			return err
+		}
+		version, err := schemaVersion(ctx, s.NextReader())
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		stats.Shards[id-1].Rows, stats.Shards[id-1].SchemaVersion = rows, version
+		mu.Unlock()
+		return nil
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	backups := l.lastBackups()
+	for i := range stats.Shards {
+		st := &stats.Shards[i]
+		if err := errs[st.ShardID]; err != nil {
+			st.Error = err.Error()
+		}
+		st.SizeBytes, _ = fileSize(st.Path)
+		if t, ok := backups[st.ShardID]; ok {
+			st.LastBackup = &t
+		}
+		stats.TotalRows += st.Rows
+		stats.TotalBytes += st.SizeBytes
+	}
+	if t, ok := backups[0]; ok {
+		stats.LastBackup = &t
+	}
+	stats.Volumes = l.Config.volumes()
+	return stats, nil
+}
+
+// volumes returns the VolumeStats of every base path and tier directory.
+func (c *Config) volumes() []VolumeStats {
+	paths := c.searchPaths()
+	volumes := make([]VolumeStats, len(paths))
+	for i, path := range paths {
+		v := &volumes[i]
+		v.Path = path
+		var err error
+		if v.TotalBytes, v.UsedBytes, v.FreeBytes, err = diskSpace(path); err != nil {
+			v.Error = err.Error()
+		}
+	}
+	return volumes
+}
+
+// statusLocked returns the Status* constant describing shard id. l.mu must
+// be held.
+func (l *Litebeam) statusLocked(id int) string {
+	switch {
+	case l.quarantined[id] != nil:
+		return StatusQuarantined
+	case l.moving[id]:
+		return StatusMoving
+	case l.Shards[id] != nil:
+		return StatusOpen
+	}
+	return StatusClosed
+}
+
+// lastBackups returns the time of the newest backup set in BackupDir
+// holding each shard, keyed by shard ID, and of the newest set at all
+// under key 0.
+func (l *Litebeam) lastBackups() map[int]time.Time {
+	last := map[int]time.Time{}
+	if l.Config.BackupDir == "" {
+		return last
+	}
+	sets, err := backupSets(l.Config.BackupDir)
+	if err != nil {
+		return last
+	}
+	for _, set := range sets {
+		t := set.time
+		manifest, err := ReadManifest(filepath.Join(l.Config.BackupDir, t.Format(backupSetLayout), ManifestFile))
+		if err != nil {
+			continue
+		}
+		if _, ok := last[0]; !ok {
+			last[0] = t
+		}
+		for _, b := range manifest.Shards {
+			if _, ok := last[b.ShardID]; !ok && b.Error == "" {
+				last[b.ShardID] = t
+			}
+		}
+		if len(last) > l.Config.TotalShards {
+			break
+		}
+	}
+	return last
+}
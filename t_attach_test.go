@@ -0,0 +1,57 @@
+package litebeam
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ncruces/go-sqlite3/driver"
+)
+
+func TestAttachSQL(t *testing.T) {
+	// URI characters in the path must be escaped.
+	base := t.TempDir() + "/data #1?%20/"
+	l, err := NewLitebeam(Config{BasePath: base, TotalShards: 3, InitSchemaFunc: itemsSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := 1; id <= 3; id++ {
+		s, err := l.GetShard(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Writer.Exec("INSERT INTO items (id) VALUES (1)"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	script, err := l.AttachSQL(t.Context(), AttachOptions{Immutable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := driver.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	conn, err := db.Conn(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, stmt := range strings.Split(strings.TrimSpace(script), ";\n") {
+		if _, err := conn.ExecContext(t.Context(), stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	var n, shards int
+	if err := conn.QueryRowContext(t.Context(), "SELECT count(*), count(DISTINCT shard_id) FROM items").Scan(&n, &shards); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || shards != 3 {
+		t.Fatalf("expected 3 rows from 3 shards, got %d from %d", n, shards)
+	}
+}
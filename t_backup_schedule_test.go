@@ -0,0 +1,151 @@
+package litebeam
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeBackupSet writes an empty scheduled backup set taken at t, with a
+// failed shard if failed is set.
+func writeBackupSet(t *testing.T, dir string, at time.Time, failed bool) {
+	t.Helper()
+	set := filepath.Join(dir, at.Format(backupSetLayout))
+	if err := os.Mkdir(set, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := BackupManifest{CreatedAt: at, TotalShards: 1, Shards: []ShardBackup{{ShardID: 1}}}
+	if failed {
+		manifest.Shards[0].Error = "shard is quarantined"
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(set, ManifestFile), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	// Two sets a day for 20 days.
+	for i := range 40 {
+		writeBackupSet(t, dir, start.Add(time.Duration(i)*12*time.Hour), false)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "not-a-set"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pruneBackups(dir, BackupRetention{KeepLast: 3, KeepDaily: 5, KeepWeekly: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if !slices.Contains(names, "not-a-set") {
+		t.Fatal("expected unrelated directories to be left alone")
+	}
+	// The last 3 sets, plus the newest of 5 days (2 already kept), plus
+	// the newest of 4 weeks (2 already kept).
+	if len(names) != 1+3+3+2 {
+		t.Fatalf("unexpected sets kept: %v", names)
+	}
+	if !slices.Contains(names, "20240303T120000Z") || slices.Contains(names, "20240301T120000Z") {
+		t.Fatalf("unexpected sets kept: %v", names)
+	}
+}
+
+func TestPruneBackupsIncomplete(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	// One complete set followed by four with a failed shard.
+	for i := range 5 {
+		writeBackupSet(t, dir, start.Add(time.Duration(i)*time.Hour), i > 0)
+	}
+
+	if err := pruneBackups(dir, BackupRetention{KeepLast: 1}); err != nil {
+		t.Fatal(err)
+	}
+	sets, err := backupSets(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The newest incomplete set and the newest complete one.
+	if len(sets) != 2 || sets[0].complete || !sets[1].complete || !sets[1].time.Equal(start) {
+		t.Fatalf("unexpected sets kept: %+v", sets)
+	}
+}
+
+func TestScheduledBackupQuarantined(t *testing.T) {
+	backups := t.TempDir()
+	l, err := NewLitebeam(Config{
+		BasePath:        t.TempDir(),
+		TotalShards:     2,
+		BackupDir:       backups,
+		BackupInterval:  time.Hour,
+		BackupRetention: BackupRetention{KeepLast: 1},
+		Quiet:           true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.Quarantine(2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every set fails for shard 2 but old ones are still pruned. Set
+	// names have a resolution of a second.
+	for range 2 {
+		l.backupScheduled()
+		time.Sleep(time.Second)
+	}
+	sets, err := backupSets(backups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sets) != 1 {
+		t.Fatalf("expected 1 set kept, got %+v", sets)
+	}
+}
+
+func TestScheduledBackup(t *testing.T) {
+	dir := t.TempDir()
+	backups := t.TempDir()
+	l, err := NewLitebeam(Config{
+		BasePath:        dir,
+		TotalShards:     1,
+		BackupDir:       backups,
+		BackupInterval:  50 * time.Millisecond,
+		BackupRetention: BackupRetention{KeepLast: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		matches, _ := filepath.Glob(filepath.Join(backups, "*", ManifestFile))
+		if len(matches) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a scheduled backup, found %v", matches)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,389 @@
+package litebeam
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ncruces/go-sqlite3/driver"
+)
+
+func itemsSchema(db *sql.DB) error {
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS items (id INTEGER PRIMARY KEY)")
+	return err
+}
+
+func TestBackupShard(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 1, InitSchemaFunc: itemsSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s, err := l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("INSERT INTO items SELECT value FROM generate_series(1, 100)"); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "backup", "shard_1.db")
+	for range 2 {
+		if err := l.BackupShard(t.Context(), 1, dst); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := driver.Open("file:" + dst + "?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM items").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 {
+		t.Fatalf("expected 100 rows in the backup, got %d", n)
+	}
+}
+
+func TestBackupAll(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 3, InitSchemaFunc: itemsSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s, err := l.GetShard(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("INSERT INTO items SELECT value FROM generate_series(1, 10)"); err != nil {
+		t.Fatal(err)
+	}
+
+	backupDir := t.TempDir()
+	manifest, err := l.BackupAll(t.Context(), backupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Shards) != 3 {
+		t.Fatalf("expected 3 shards in the manifest, got %d", len(manifest.Shards))
+	}
+	for _, b := range manifest.Shards {
+		if b.Size == 0 || len(b.SHA256) != 64 {
+			t.Fatalf("shard %d: incomplete manifest entry %+v", b.ShardID, b)
+		}
+		want := int64(0)
+		if b.ShardID == 2 {
+			want = 10
+		}
+		if b.Rows != want {
+			t.Fatalf("shard %d: unexpected row count %d", b.ShardID, b.Rows)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(backupDir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written BackupManifest
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	if len(written.Shards) != 3 || written.Shards[1].SHA256 != manifest.Shards[1].SHA256 {
+		t.Fatalf("unexpected manifest on disk %+v", written)
+	}
+}
+
+func TestRestoreShard(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 1, InitSchemaFunc: itemsSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s, err := l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("INSERT INTO items VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	backup := filepath.Join(t.TempDir(), "shard_1.db")
+	if err := l.BackupShard(t.Context(), 1, backup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("INSERT INTO items VALUES (2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.RestoreShard(t.Context(), 1, backup); err != nil {
+		t.Fatal(err)
+	}
+	s, err = l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := s.Reader.QueryRow("SELECT count(*) FROM items").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected the restored shard to hold 1 row, got %d", n)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.db")
+	if err := os.WriteFile(bad, []byte("not a database, not at all"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.RestoreShard(t.Context(), 1, bad); err == nil {
+		t.Fatal("expected a bad backup to be rejected")
+	}
+}
+
+func TestRestoreAll(t *testing.T) {
+	dir := t.TempDir()
+	conf := Config{BasePath: dir, TotalShards: 2, InitSchemaFunc: itemsSchema}
+	l, err := NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.RangeShards(func(id int, s *Shard) error {
+		_, err := s.Writer.Exec("INSERT INTO items VALUES (?)", id)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	backupDir := t.TempDir()
+	if _, err := l.BackupAll(t.Context(), backupDir); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	// Restore into an empty BasePath.
+	conf.BasePath = t.TempDir()
+	l, err = NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.RestoreAll(t.Context(), filepath.Join(backupDir, ManifestFile)); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.RangeShards(func(id int, s *Shard) error {
+		var got int
+		if err := s.Reader.QueryRow("SELECT id FROM items").Scan(&got); err != nil {
+			return err
+		}
+		if got != id {
+			t.Fatalf("shard %d: expected restored row %d, got %d", id, id, got)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A tampered file fails its checksum.
+	f, err := os.OpenFile(filepath.Join(backupDir, "shard_1.db"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("x"))
+	f.Close()
+	if err := l.RestoreAll(t.Context(), filepath.Join(backupDir, ManifestFile)); err == nil {
+		t.Fatal("expected a checksum mismatch")
+	}
+}
+
+func TestBackupAllToTar(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 2, InitSchemaFunc: itemsSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var buf bytes.Buffer
+	target := NewTarTarget(&buf)
+	manifest, err := l.BackupAllTo(t.Context(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sums := map[string]string{}
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, tr); err != nil {
+			t.Fatal(err)
+		}
+		sums[hdr.Name] = hex.EncodeToString(h.Sum(nil))
+	}
+	if _, ok := sums[ManifestFile]; !ok || len(sums) != 3 {
+		t.Fatalf("expected two shards and a manifest, got %v", sums)
+	}
+	for _, b := range manifest.Shards {
+		if sums[b.Path] != b.SHA256 {
+			t.Fatalf("shard %d: archived file does not match the manifest", b.ShardID)
+		}
+	}
+}
+
+func TestGzipBackup(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 2, InitSchemaFunc: itemsSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.RangeShards(func(id int, s *Shard) error {
+		_, err := s.Writer.Exec("INSERT INTO items SELECT value FROM generate_series(1, 1000)")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	backupDir := t.TempDir()
+	manifest, err := l.BackupAllTo(t.Context(), GzipTarget{Target: DirTarget(backupDir)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range manifest.Shards {
+		info, err := os.Stat(filepath.Join(backupDir, b.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Compression != "gzip" || info.Size() >= b.Size {
+			t.Fatalf("shard %d: expected a smaller gzip file, got %+v and %d bytes", b.ShardID, b, info.Size())
+		}
+	}
+
+	if _, err := l.GetShard(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.RestoreAll(t.Context(), filepath.Join(backupDir, ManifestFile)); err != nil {
+		t.Fatal(err)
+	}
+	s, err := l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := s.Reader.QueryRow("SELECT count(*) FROM items").Scan(&n); err != nil || n != 1000 {
+		t.Fatalf("expected 1000 restored rows, got %d, %v", n, err)
+	}
+}
+
+// countingTarget wraps another target, as callers might for logging.
+type countingTarget struct {
+	BackupTarget
+	files int
+}
+
+func (c *countingTarget) Create(ctx context.Context, name string, size int64) (io.WriteCloser, error) {
+	c.files++
+	return c.BackupTarget.Create(ctx, name, size)
+}
+
+func TestGzipBackupWrapped(t *testing.T) {
+	l, err := NewLitebeam(Config{BasePath: t.TempDir(), TotalShards: 2, InitSchemaFunc: itemsSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	backupDir := t.TempDir()
+	target := &countingTarget{BackupTarget: &GzipTarget{Target: DirTarget(backupDir)}}
+	manifest, err := l.BackupAllTo(t.Context(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.files != 3 {
+		t.Fatalf("expected 2 shards and the manifest, got %d files", target.files)
+	}
+	for _, b := range manifest.Shards {
+		if b.Compression != "gzip" || filepath.Ext(b.Path) != ".gz" {
+			t.Fatalf("shard %d: expected a gzip file, got %+v", b.ShardID, b)
+		}
+	}
+	if _, err := ReadManifest(filepath.Join(backupDir, ManifestFile)); err != nil {
+		t.Fatalf("expected an uncompressed manifest: %v", err)
+	}
+}
+
+func TestVerifyBackup(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 2, InitSchemaFunc: itemsSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s, err := l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("INSERT INTO items VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	backupDir := t.TempDir()
+	if _, err := l.BackupAll(t.Context(), backupDir); err != nil {
+		t.Fatal(err)
+	}
+	manifestPath := filepath.Join(backupDir, ManifestFile)
+
+	// Every shard must hold at least one item.
+	validate := func(ctx context.Context, shardID int, db *sql.DB) error {
+		var n int
+		if err := db.QueryRowContext(ctx, "SELECT count(*) FROM items").Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			return errors.New("no items")
+		}
+		return nil
+	}
+	results, err := VerifyBackup(t.Context(), manifestPath, nil, validate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[1] != nil || results[2] == nil {
+		t.Fatalf("expected only shard 2 to fail validation, got %v", results)
+	}
+
+	if err := os.WriteFile(filepath.Join(backupDir, "shard_1.db"), []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	results, err = VerifyBackup(t.Context(), manifestPath, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[1] == nil || results[2] != nil {
+		t.Fatalf("expected only shard 1 to fail, got %v", results)
+	}
+}
@@ -0,0 +1,33 @@
+package litebeam
+
+import "testing"
+
+func TestClose(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    t.TempDir(),
+		TotalShards: 3,
+		ReaderPools: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var shards []*Shard
+	for _, s := range l.Shards {
+		shards = append(shards, s)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Shards) != 0 {
+		t.Fatalf("expected no open shards after close, got %d", len(l.Shards))
+	}
+	for _, s := range shards {
+		for _, db := range s.dbs() {
+			if err := db.Ping(); err == nil {
+				t.Fatal("expected pool to be closed")
+			}
+		}
+	}
+}
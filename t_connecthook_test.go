@@ -0,0 +1,33 @@
+package litebeam
+
+import (
+	"testing"
+
+	"github.com/ncruces/go-sqlite3"
+)
+
+func TestConnectHook(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    t.TempDir(),
+		TotalShards: 2,
+		ConnectHook: func(shardID int, conn *sqlite3.Conn) error {
+			return conn.CreateFunction("shard_id", 0, sqlite3.DETERMINISTIC, func(ctx sqlite3.Context, arg ...sqlite3.Value) {
+				ctx.ResultInt(shardID)
+			})
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for id, s := range l.Shards {
+		var got int
+		if err := s.Reader.QueryRow("SELECT shard_id()").Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != id {
+			t.Fatalf("expected shard_id() %d, got %d", id, got)
+		}
+	}
+}
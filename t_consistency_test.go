@@ -0,0 +1,76 @@
+package litebeam
+
+import (
+	"os"
+	"testing"
+)
+
+func TestConsistencyFreshPath(t *testing.T) {
+	c := Config{
+		BasePath:          t.TempDir(),
+		TotalShards:       3,
+		ConsistencyPolicy: ConsistencyFail,
+	}
+	l, err := NewLitebeam(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	report, err := l.CheckConsistency()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Fatalf("expected consistent report, got %s", report)
+	}
+}
+
+func TestConsistencyFailOnUnexpected(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	_, err = NewLitebeam(Config{
+		BasePath:          dir,
+		TotalShards:       2,
+		ConsistencyPolicy: ConsistencyFail,
+	})
+	if err == nil {
+		t.Fatal("expected error for unexpected shard file")
+	}
+}
+
+func TestConsistencyRepairUnreadable(t *testing.T) {
+	dir := t.TempDir() + "/"
+	if err := os.WriteFile(dir+"shard_1.db", []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A WAL left behind must go with it rather than be replayed.
+	if err := os.WriteFile(dir+"shard_1.db-wal", []byte("stale wal"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := NewLitebeam(Config{
+		BasePath:          dir,
+		TotalShards:       2,
+		ConsistencyPolicy: ConsistencyRepair,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if _, err := os.Stat(dir + "shard_1.db" + corruptSuffix); err != nil {
+		t.Fatalf("expected unreadable shard to be moved aside: %v", err)
+	}
+	if _, err := os.Stat(dir + "shard_1.db" + corruptSuffix + "-wal"); err != nil {
+		t.Fatalf("expected the WAL to be moved aside with the shard: %v", err)
+	}
+	if err := l.Shards[1].Writer.Ping(); err != nil {
+		t.Fatalf("expected repaired shard to open: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package litebeam
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportImportManifest(t *testing.T) {
+	src := t.TempDir() + "/"
+	l, err := NewLitebeam(Config{BasePath: src, TotalShards: 3, InitSchemaFunc: itemsSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := l.GetShard(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("INSERT INTO items (id) VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	var manifest bytes.Buffer
+	if err := l.ExportManifest(t.Context(), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir() + "/"
+	for id := 1; id <= 3; id++ {
+		name := fmt.Sprintf(dbFilePattern, id)
+		data, err := os.ReadFile(filepath.Join(src, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dst, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l, err = NewLitebeam(Config{BasePath: dst, TotalShards: 3, InitSchemaFunc: itemsSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if err := l.ImportManifest(t.Context(), bytes.NewReader(manifest.Bytes())); err != nil {
+		t.Fatalf("expected copied dataset to match, got %v", err)
+	}
+
+	s, err = l.GetShard(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("INSERT INTO items (id) VALUES (2)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.ImportManifest(t.Context(), bytes.NewReader(manifest.Bytes())); err == nil {
+		t.Fatal("expected changed shard to fail the check")
+	}
+}
@@ -0,0 +1,60 @@
+package litebeam
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestCheckSchemaDrift(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    t.TempDir(),
+		TotalShards: 3,
+		InitSchemaFunc: func(db *sql.DB) error {
+			_, err := db.Exec(`CREATE TABLE IF NOT EXISTS users (
+				id   TEXT PRIMARY KEY,
+				name TEXT
+			)`)
+			return err
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	drifts, err := l.CheckSchemaDrift(t.Context(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Fatalf("expected no drift, got %+v", drifts)
+	}
+
+	if _, err := l.Shards[2].Writer.Exec("ALTER TABLE users ADD COLUMN email TEXT; CREATE INDEX users_name ON users (name)"); err != nil {
+		t.Fatal(err)
+	}
+
+	drifts, err = l.CheckSchemaDrift(t.Context(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 1 || drifts[0].ShardID != 2 {
+		t.Fatalf("expected drift on shard 2 only, got %+v", drifts)
+	}
+	d := drifts[0]
+	if len(d.Changed) != 1 || d.Changed[0] != "users" || len(d.Extra) != 1 || d.Extra[0] != "users_name" {
+		t.Fatalf("unexpected drift: %+v", d)
+	}
+
+	reference, err := l.ShardSchema(t.Context(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drifts, err = l.CheckSchemaDrift(t.Context(), reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 2 {
+		t.Fatalf("expected shards 1 and 3 to drift from shard 2, got %+v", drifts)
+	}
+}
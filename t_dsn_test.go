@@ -0,0 +1,157 @@
+package litebeam
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestShardDSNPragmas(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    t.TempDir(),
+		TotalShards: 1,
+		DSNParams:   url.Values{"_pragma": {"user_version(7)"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var mode string
+	if err := l.Shards[1].Reader.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Fatalf("expected wal journal mode, got %s", mode)
+	}
+
+	var version int
+	if err := l.Shards[1].Reader.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != 7 {
+		t.Fatalf("expected user_version 7 from DSNParams, got %d", version)
+	}
+}
+
+func TestShardDSNReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	l, err = NewLitebeam(Config{BasePath: dir, TotalShards: 1, ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Shards[1].Writer.Exec("CREATE TABLE t (id INTEGER)"); err == nil {
+		t.Fatal("expected write to a read-only shard to fail")
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShardDSNSizes(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    t.TempDir(),
+		TotalShards: 1,
+		CacheSize:   -2000,
+		MmapSize:    1 << 20,
+		PageSize:    8192,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	r := l.Shards[1].Reader
+	for pragma, want := range map[string]int64{
+		"cache_size": -2000,
+		"page_size":  8192,
+	} {
+		var got int64
+		if err := r.QueryRow("PRAGMA " + pragma).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("expected %s %d, got %d", pragma, want, got)
+		}
+	}
+}
+
+func TestImmutableShards(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Shards[2].Writer.Exec("CREATE TABLE t (id INTEGER); INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = NewLitebeam(Config{BasePath: dir, TotalShards: 2, ImmutableShards: []int{2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := l.Shards[2].Reader.QueryRow("SELECT count(*) FROM t").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 row in immutable shard, got %d", n)
+	}
+	if _, err := l.Shards[2].Writer.Exec("INSERT INTO t VALUES (2)"); err == nil {
+		t.Fatal("expected write to an immutable shard to fail")
+	}
+	if _, err := l.Shards[1].Writer.Exec("CREATE TABLE t (id INTEGER)"); err != nil {
+		t.Fatalf("expected other shards to stay writable: %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadOnlyRefusesWrites(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	l, err = NewLitebeam(Config{BasePath: dir, TotalShards: 1, ReadOnly: true, Migrations: testMigrations})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if _, err := l.Migrate(t.Context()); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected Migrate to return ErrReadOnly, got %v", err)
+	}
+	if _, err := l.MigrateWithOptions(t.Context(), MigrateOptions{DryRun: true}); err != nil {
+		t.Fatalf("expected a dry run to work read-only: %v", err)
+	}
+	if _, err := l.Rollback(t.Context()); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected Rollback to return ErrReadOnly, got %v", err)
+	}
+	if _, err := l.CleanOrphans(); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected CleanOrphans to return ErrReadOnly, got %v", err)
+	}
+	if err := l.SetShardLabels(t.Context(), 1, map[string]string{"a": "b"}); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected SetShardLabels to return ErrReadOnly, got %v", err)
+	}
+	if err := l.RestoreShard(t.Context(), 1, l.Config.shardPath(1)); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected RestoreShard to return ErrReadOnly, got %v", err)
+	}
+	if _, err := l.GetShardLabels(t.Context(), 1); err != nil {
+		t.Fatalf("expected reads to work: %v", err)
+	}
+}
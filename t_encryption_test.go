@@ -0,0 +1,202 @@
+package litebeam
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type testKeys struct{}
+
+func (testKeys) KeyFor(shardID int) ([]byte, error) {
+	return bytes.Repeat([]byte{byte(shardID)}, keySize), nil
+}
+
+func TestEncryptedShards(t *testing.T) {
+	dir := t.TempDir()
+	conf := Config{
+		BasePath:            dir,
+		TotalShards:         2,
+		InitSchemaFunc:      itemsSchema,
+		SchemaTemplateShard: 1,
+		KeyProvider:         testKeys{},
+	}
+	l, err := NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("INSERT INTO items VALUES (99)"); err != nil {
+		t.Fatal(err)
+	}
+
+	backupDir := t.TempDir()
+	if _, err := l.BackupAll(t.Context(), backupDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{filepath.Join(dir, "shard_1.db"), filepath.Join(backupDir, "shard_1.db")} {
+		if isSQLiteFile(path) {
+			t.Fatalf("expected %s to be encrypted", path)
+		}
+	}
+
+	results, err := VerifyBackup(t.Context(), filepath.Join(backupDir, ManifestFile), testKeys{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, err := range results {
+		if err != nil {
+			t.Fatalf("shard %d: %v", id, err)
+		}
+	}
+
+	// Reopening needs the right keys and keeps the data.
+	conf.ConsistencyPolicy = ConsistencyFail
+	l, err = NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.RestoreShard(t.Context(), 1, filepath.Join(backupDir, "shard_1.db")); err != nil {
+		t.Fatal(err)
+	}
+	s, err = l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	if err := s.Reader.QueryRow("SELECT id FROM items").Scan(&id); err != nil || id != 99 {
+		t.Fatalf("expected the encrypted row, got %d, %v", id, err)
+	}
+}
+
+type rotatingKeys struct {
+	mu   sync.Mutex
+	keys map[int][]byte
+}
+
+func (k *rotatingKeys) KeyFor(shardID int) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if key, ok := k.keys[shardID]; ok {
+		return key, nil
+	}
+	return testKeys{}.KeyFor(shardID)
+}
+
+func (k *rotatingKeys) SetKey(shardID int, key []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[shardID] = key
+	return nil
+}
+
+func TestRotateKeys(t *testing.T) {
+	dir := t.TempDir()
+	keys := &rotatingKeys{keys: map[int][]byte{}}
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 2, InitSchemaFunc: itemsSchema, KeyProvider: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s, err := l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("INSERT INTO items VALUES (5)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var progress []ShardProgress
+	results := l.RotateKeys(t.Context(), func(id int) ([]byte, error) {
+		return bytes.Repeat([]byte{0xa0 + byte(id)}, keySize), nil
+	}, func(p ShardProgress) { progress = append(progress, p) })
+	for id, err := range results {
+		if err != nil {
+			t.Fatalf("shard %d: %v", id, err)
+		}
+	}
+	if len(progress) != 2 || progress[1].Done != 2 {
+		t.Fatalf("unexpected progress %+v", progress)
+	}
+
+	oldKey, _ := testKeys{}.KeyFor(1)
+	if err := quickCheck(t.Context(), filepath.Join(dir, "shard_1.db"), oldKey); err == nil {
+		t.Fatal("expected the old key to no longer open the shard")
+	}
+	s, err = l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	if err := s.Reader.QueryRow("SELECT id FROM items").Scan(&id); err != nil || id != 5 {
+		t.Fatalf("expected the row to survive rotation, got %d, %v", id, err)
+	}
+
+	if err := l.RotateShardKey(t.Context(), 1, []byte("short")); err == nil {
+		t.Fatal("expected a short key to be rejected")
+	}
+}
+
+// failingKeys replaces the shard file with a directory when a new key is
+// stored, so swapping in the re-encrypted file fails.
+type failingKeys struct {
+	*rotatingKeys
+	path string
+}
+
+func (k failingKeys) SetKey(shardID int, key []byte) error {
+	if !bytes.Equal(key, testKeys{}.mustKey(shardID)) {
+		if err := os.Rename(k.path, k.path+".saved"); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Join(k.path, "blocker"), 0o755); err != nil {
+			return err
+		}
+	}
+	return k.rotatingKeys.SetKey(shardID, key)
+}
+
+func (k testKeys) mustKey(shardID int) []byte {
+	key, _ := k.KeyFor(shardID)
+	return key
+}
+
+func TestRotateShardKeyRenameFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "shard_1.db")
+	keys := failingKeys{&rotatingKeys{keys: map[int][]byte{}}, path}
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 1, InitSchemaFunc: itemsSchema, KeyProvider: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	newKey := bytes.Repeat([]byte{0xee}, keySize)
+	if err := l.RotateShardKey(t.Context(), 1, newKey); err == nil {
+		t.Fatal("expected the rotation to fail")
+	}
+	key, _ := keys.KeyFor(1)
+	if !bytes.Equal(key, testKeys{}.mustKey(1)) {
+		t.Fatal("expected the old key to be restored")
+	}
+
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path+".saved", path); err != nil {
+		t.Fatal(err)
+	}
+	if err := quickCheck(t.Context(), path, key); err != nil {
+		t.Fatalf("expected the old file to open with the old key: %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package litebeam
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLifecycleCallbacks(t *testing.T) {
+	var (
+		l        *Litebeam
+		created  []int
+		restored []int
+	)
+	l, err := NewLitebeam(Config{
+		BasePath:      t.TempDir(),
+		TotalShards:   3,
+		MaxOpenShards: 3,
+		OnShardCreated: func(info ShardInfo) {
+			created = append(created, info.ID)
+			// Callbacks run without the lock held, so they may use l.
+			if _, err := l.GetShard(info.ID); err != nil {
+				t.Error(err)
+			}
+		},
+		OnShardRestored: func(shardID int, src string) {
+			restored = append(restored, shardID)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for id := 1; id <= 3; id++ {
+		if _, err := l.GetShard(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(created, []int{1, 2, 3}) {
+		t.Fatalf("expected shards 1, 2 and 3 created once each, got %v", created)
+	}
+
+	backup := filepath.Join(t.TempDir(), "shard_2.db")
+	if err := l.BackupShard(t.Context(), 2, backup); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.RestoreShard(t.Context(), 2, backup); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(restored, []int{2}) {
+		t.Fatalf("expected shard 2 restored, got %v", restored)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	sink := newRecordingSink()
+	l, err := NewLitebeam(Config{BasePath: t.TempDir(), TotalShards: 3, MaxOpenShards: 3, EventBuffer: 2, MetricsSink: sink})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, cancel := l.Subscribe()
+	defer cancel()
+
+	for id := 1; id <= 3; id++ {
+		if _, err := l.GetShard(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id := 1; id <= 2; id++ {
+		e := <-events
+		if e.Type != EventShardCreated || e.ShardID != id || e.Path == "" {
+			t.Fatalf("expected shard %d created, got %+v", id, e)
+		}
+	}
+	sink.mu.Lock()
+	dropped := sink.counters["events.dropped"]
+	sink.mu.Unlock()
+	if dropped != 1 {
+		t.Fatalf("expected 1 dropped event, got %d", dropped)
+	}
+
+	if err := l.Quarantine(2, errors.New("broken")); err != nil {
+		t.Fatal(err)
+	}
+	if e := <-events; e.Type != EventShardQuarantined || e.ShardID != 2 || e.Err == nil {
+		t.Fatalf("expected shard 2 quarantined, got %+v", e)
+	}
+
+	l.Close()
+	if _, ok := <-events; ok {
+		t.Fatal("expected the channel to be closed by Close")
+	}
+}
@@ -0,0 +1,47 @@
+package litebeam
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestExecOnAll(t *testing.T) {
+	dir := t.TempDir() + "/"
+	l, err := NewLitebeam(Config{
+		BasePath:       dir,
+		TotalShards:    4,
+		MaxOpenShards:  4,
+		InitSchemaFunc: itemsSchema,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for id := 1; id <= 3; id++ {
+		s, err := l.GetShard(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Writer.Exec("INSERT INTO items (id) VALUES (1), (2)"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(dir+"shard_4.db", []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := l.ExecOnAll(t.Context(), "DELETE FROM items WHERE id = ?", 2)
+	if err == nil {
+		t.Fatal("expected an error from the corrupt shard")
+	}
+	if !errors.Is(results[4].Err, ErrShardCorrupt) {
+		t.Fatalf("expected shard 4 to fail as corrupt, got %v", results[4].Err)
+	}
+	for id := 1; id <= 3; id++ {
+		if r := results[id]; r.Err != nil || r.RowsAffected != 1 {
+			t.Fatalf("expected 1 row deleted from shard %d, got %+v", id, r)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package litebeam
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExportTableCSV(t *testing.T) {
+	l, err := NewLitebeam(Config{BasePath: t.TempDir() + "/", TotalShards: 2, InitSchemaFunc: itemsSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for id := 1; id <= 2; id++ {
+		s, err := l.GetShard(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Writer.Exec("INSERT INTO items (id) VALUES (?)", id*10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := l.ExportTable(t.Context(), "items", ExportCSV, &buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "shard_id,id\n1,10\n2,20\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	if err := l.ExportTable(t.Context(), "missing", ExportCSV, &buf); err == nil || !strings.Contains(err.Error(), "shard 1") {
+		t.Fatalf("expected error for missing table, got %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package litebeam
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGetShard(t *testing.T) {
+	l, err := NewLitebeam(Config{BasePath: t.TempDir(), TotalShards: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := l.GetShard(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := l.GetShard(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Fatal("expected the same cached shard on repeated calls")
+	}
+
+	if _, err := l.GetShard(4); err == nil {
+		t.Fatal("expected error for out of range shard")
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.GetShard(1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestGetShardEviction(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:      t.TempDir(),
+		TotalShards:   5,
+		MaxOpenShards: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if len(l.Shards) != 0 {
+		t.Fatalf("expected no shards open at startup, got %d", len(l.Shards))
+	}
+
+	for _, id := range []int{1, 2, 1, 3} {
+		if _, err := l.GetShard(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(l.Shards) != 2 {
+		t.Fatalf("expected 2 open shards, got %d", len(l.Shards))
+	}
+	if _, ok := l.Shards[2]; ok {
+		t.Fatal("expected least recently used shard 2 to be evicted")
+	}
+	if _, ok := l.Shards[1]; !ok {
+		t.Fatal("expected recently used shard 1 to stay open")
+	}
+}
+
+func TestGetShardConnBudget(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    t.TempDir(),
+		TotalShards: 5,
+		ConnBudget:  2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for id := 1; id <= 5; id++ {
+		if _, err := l.GetShard(id); err != nil {
+			t.Fatal(err)
+		}
+		if _, conns := l.OpenCounts(); conns > 2 {
+			t.Fatalf("expected at most 2 open connections, got %d", conns)
+		}
+	}
+
+	// Hold a connection on every open shard so none can be evicted.
+	for _, s := range l.openShards() {
+		conn, err := s.Writer.Conn(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+	}
+	if _, err := l.GetShard(1); !errors.Is(err, ErrOpenLimit) {
+		t.Fatalf("expected ErrOpenLimit, got %v", err)
+	}
+}
+
+func TestGetShardValidation(t *testing.T) {
+	dir := t.TempDir() + "/"
+	if err := os.WriteFile(dir+"shard_1.db", []byte("definitely not sqlite"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := NewLitebeam(Config{
+		BasePath:          dir,
+		TotalShards:       2,
+		MaxOpenShards:     2,
+		ConsistencyPolicy: ConsistencyWarn,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	_, err = l.GetShard(1)
+	var se *ShardError
+	if !errors.As(err, &se) || se.ID != 1 {
+		t.Fatalf("expected ShardError for shard 1, got %v", err)
+	}
+	if !errors.Is(err, ErrShardCorrupt) {
+		t.Fatalf("expected ErrShardCorrupt, got %v", err)
+	}
+
+	if _, err := l.GetShard(2); err != nil {
+		t.Fatalf("expected healthy shard to open: %v", err)
+	}
+}
+
+func TestGetShardMissingReadOnly(t *testing.T) {
+	_, err := NewLitebeam(Config{
+		BasePath:    t.TempDir(),
+		TotalShards: 1,
+		ReadOnly:    true,
+	})
+	if !errors.Is(err, ErrShardMissing) {
+		t.Fatalf("expected ErrShardMissing, got %v", err)
+	}
+}
+
+func TestAcquireShard(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:      t.TempDir(),
+		TotalShards:   3,
+		MaxOpenShards: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s, release, err := l.AcquireShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.GetShard(2); !errors.Is(err, ErrOpenLimit) {
+		t.Fatalf("expected leased shard to block eviction, got %v", err)
+	}
+
+	release()
+	release()
+	if _, err := l.GetShard(2); err != nil {
+		t.Fatalf("expected released shard to be evictable: %v", err)
+	}
+	if err := s.Writer.Ping(); err == nil {
+		t.Fatal("expected evicted shard to be closed")
+	}
+}
+
+func TestShardIdleTTL(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:     t.TempDir(),
+		TotalShards:  2,
+		ShardIdleTTL: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if _, err := l.GetShard(1); err != nil {
+		t.Fatal(err)
+	}
+	_, release, err := l.AcquireShard(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		open := l.openShards()
+		if _, ok := open[1]; !ok {
+			if _, ok := open[2]; !ok {
+				t.Fatal("expected leased shard 2 to stay open")
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected idle shard 1 to be closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGetShardOpensConcurrently(t *testing.T) {
+	unblock := make(chan struct{})
+	l, err := NewLitebeam(Config{
+		BasePath:      t.TempDir(),
+		TotalShards:   2,
+		MaxOpenShards: 2,
+		InitShardFunc: func(ctx context.Context, info ShardInfo, db *sql.DB) error {
+			if info.ID == 1 {
+				<-unblock
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	got := make(chan *Shard, 2)
+	for range 2 {
+		go func() {
+			s, err := l.GetShard(1)
+			if err != nil {
+				t.Error(err)
+			}
+			got <- s
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Shard 2 opens while shard 1 is still opening.
+	done := make(chan error, 1)
+	go func() {
+		_, err := l.GetShard(2)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		close(unblock)
+		t.Fatal("opening shard 2 waited for shard 1")
+	}
+	close(unblock)
+	if a, b := <-got, <-got; a == nil || a != b {
+		t.Fatalf("expected both callers to get the same shard, got %p and %p", a, b)
+	}
+	if shards, _ := l.OpenCounts(); shards != 2 {
+		t.Fatalf("expected 2 open shards, got %d", shards)
+	}
+}
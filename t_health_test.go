@@ -0,0 +1,101 @@
+package litebeam
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestPingAll(t *testing.T) {
+	dir := t.TempDir() + "/"
+	l, err := NewLitebeam(Config{
+		BasePath:      dir,
+		TotalShards:   6,
+		MaxOpenShards: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if err := os.WriteFile(dir+"shard_4.db", []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	results := l.PingAll(t.Context(), 4)
+	if len(results) != 6 {
+		t.Fatalf("expected 6 results, got %d", len(results))
+	}
+	for id, err := range results {
+		if id == 4 {
+			if !errors.Is(err, ErrShardCorrupt) {
+				t.Fatalf("expected shard 4 to be corrupt, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("shard %d: %v", id, err)
+		}
+	}
+}
+
+func TestIntegrityCheckAll(t *testing.T) {
+	dir := t.TempDir() + "/"
+	l, err := NewLitebeam(Config{
+		BasePath:    dir,
+		TotalShards: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if err := os.WriteFile(dir+"shard_3.db", []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, check := range map[string]func() map[int]error{
+		"integrity": func() map[int]error { return l.IntegrityCheckAll(t.Context(), 2) },
+		"quick":     func() map[int]error { return l.QuickCheckAll(t.Context(), 2) },
+	} {
+		results := check()
+		if len(results) != 4 {
+			t.Fatalf("%s: expected 4 results, got %d", name, len(results))
+		}
+		for id, err := range results {
+			if (id == 3) != (err != nil) {
+				t.Fatalf("%s: shard %d: unexpected result %v", name, id, err)
+			}
+		}
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	dir := t.TempDir() + "/"
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 3, MaxOpenShards: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if err := os.WriteFile(dir+"shard_2.db", []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Quarantine(3, errors.New("maintenance")); err != nil {
+		t.Fatal(err)
+	}
+
+	h := l.HealthCheck(t.Context(), HealthOptions{Concurrency: 2, QuickCheck: true})
+	if h.Healthy {
+		t.Fatal("expected an unhealthy fleet")
+	}
+	if sh := h.Shards[0]; !sh.Reachable || !sh.QuickChecked || sh.Error != "" {
+		t.Fatalf("expected shard 1 to be healthy, got %+v", sh)
+	}
+	if sh := h.Shards[1]; sh.Reachable || sh.Error == "" || sh.LastError != sh.Error || sh.LastErrorAt == nil {
+		t.Fatalf("expected shard 2 to be unreachable, got %+v", sh)
+	}
+	if sh := h.Shards[2]; sh.Status != StatusQuarantined || sh.Error != "maintenance" {
+		t.Fatalf("expected shard 3 to be quarantined, got %+v", sh)
+	}
+}
@@ -0,0 +1,34 @@
+package litebeam
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHotShards(t *testing.T) {
+	l, err := NewLitebeam(Config{BasePath: t.TempDir(), TotalShards: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for id := 1; id <= 5; id++ {
+		n := 2
+		if id == 4 {
+			n = 20
+		}
+		for range n {
+			if _, err := l.GetShard(id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	hot := l.HotShards(2*time.Minute, 3)
+	if len(hot) != 1 || hot[0].ShardID != 4 || hot[0].Requests != 20 || hot[0].Ratio != 10 {
+		t.Fatalf("expected only shard 4 to be hot, got %+v", hot)
+	}
+	if hot := l.HotShards(2*time.Minute, 20); len(hot) != 0 {
+		t.Fatalf("expected no shard above 20x the median, got %+v", hot)
+	}
+}
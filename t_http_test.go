@@ -0,0 +1,117 @@
+package litebeam
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	l, err := NewLitebeam(Config{BasePath: t.TempDir(), TotalShards: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := l.Handler()
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get("/healthz"); rec.Code != http.StatusOK {
+		t.Fatalf("expected /healthz to answer 200, got %d", rec.Code)
+	}
+	rec := get("/readyz?quick=1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected /readyz to answer 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var health Health
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	if len(health.Shards) != 2 || !health.Shards[0].QuickChecked {
+		t.Fatalf("expected 2 quick checked shards, got %+v", health)
+	}
+
+	// The other shards stay in service, so a quarantined one is listed
+	// but does not fail readiness.
+	if err := l.Quarantine(1, errors.New("broken")); err != nil {
+		t.Fatal(err)
+	}
+	rec = get("/readyz")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected /readyz to answer 200 with a quarantined shard, got %d", rec.Code)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(health.Shards[0].Error, "broken") || !health.Shards[1].Reachable {
+		t.Fatalf("expected shard 1 quarantined and shard 2 reachable, got %+v", health)
+	}
+
+	l.Close()
+	if rec := get("/healthz"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected /healthz to answer 503 after Close, got %d", rec.Code)
+	}
+}
+
+func TestReadyzLazy(t *testing.T) {
+	l, err := NewLitebeam(Config{BasePath: t.TempDir(), TotalShards: 4, MaxOpenShards: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.GetShard(3); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	l.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected /readyz to answer 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if shards, _ := l.OpenCounts(); shards != 1 {
+		t.Fatalf("expected /readyz not to open shards, got %d open", shards)
+	}
+	var health Health
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	if !health.Shards[2].Reachable || health.Shards[0].Reachable {
+		t.Fatalf("expected only shard 3 to be pinged, got %+v", health)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	l, err := NewLitebeam(Config{BasePath: t.TempDir(), TotalShards: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.Quarantine(2, errors.New("disk <failure>")); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	l.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"2 shards", StatusQuarantined, string(EventShardQuarantined), "disk &lt;failure&gt;"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected the page to contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{0: "0 B", 1023: "1023 B", 1024: "1.0 KiB", 5 << 30: "5.0 GiB"} {
+		if got := formatBytes(n); got != want {
+			t.Fatalf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
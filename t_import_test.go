@@ -0,0 +1,84 @@
+package litebeam
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/ncruces/go-sqlite3/driver"
+)
+
+func TestImportDatabase(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "mono.db")
+	db, err := driver.Open("file:" + src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, tenant TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 50; i++ {
+		if _, err := db.Exec("INSERT INTO items VALUES (?, ?)", i, fmt.Sprintf("tenant-%d", i%7)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	l, err := NewLitebeam(Config{
+		BasePath:    t.TempDir() + "/",
+		TotalShards: 3,
+		InitSchemaFunc: func(db *sql.DB) error {
+			_, err := db.Exec("CREATE TABLE IF NOT EXISTS items (id INTEGER PRIMARY KEY, tenant TEXT)")
+			return err
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	counts, err := l.ImportDatabase(t.Context(), src, ImportOptions{
+		Partition: func(table string, row map[string]any) (string, error) {
+			return row["tenant"].(string), nil
+		},
+		BatchSize: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var total int64
+	for id := 1; id <= 3; id++ {
+		s, err := l.GetShard(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int64
+		if err := s.Reader.QueryRow("SELECT count(*) FROM items").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != counts[id] {
+			t.Fatalf("shard %d: counted %d rows, has %d", id, counts[id], n)
+		}
+		total += n
+
+		rows, err := s.Reader.Query("SELECT DISTINCT tenant FROM items")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var tenant string
+			if err := rows.Scan(&tenant); err != nil {
+				t.Fatal(err)
+			}
+			if want, _ := l.AssignToShard(tenant); want != id {
+				t.Fatalf("%s imported into shard %d, assigned to %d", tenant, id, want)
+			}
+		}
+		rows.Close()
+	}
+	if total != 50 {
+		t.Fatalf("expected 50 rows imported, got %d", total)
+	}
+}
@@ -0,0 +1,58 @@
+package litebeam
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInitShardFunc(t *testing.T) {
+	dir := t.TempDir()
+	var created []bool
+	c := Config{
+		BasePath:    dir,
+		TotalShards: 2,
+		InitShardFunc: func(ctx context.Context, info ShardInfo, db *sql.DB) error {
+			created = append(created, info.Created)
+			_, err := db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS shard_%d (id INTEGER)", info.ID))
+			return err
+		},
+	}
+
+	l, err := NewLitebeam(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Shards[2].Writer.Exec("INSERT INTO shard_2 VALUES (1)"); err != nil {
+		t.Fatalf("expected per-shard table: %v", err)
+	}
+	l.Close()
+
+	l, err = NewLitebeam(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	if len(created) != 4 || !created[0] || !created[1] || created[2] || created[3] {
+		t.Fatalf("expected Created true then false for each shard, got %v", created)
+	}
+}
+
+func TestInitShardFuncTimeout(t *testing.T) {
+	_, err := NewLitebeam(Config{
+		BasePath:    t.TempDir(),
+		TotalShards: 1,
+		InitTimeout: 10 * time.Millisecond,
+		InitShardFunc: func(ctx context.Context, info ShardInfo, db *sql.DB) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
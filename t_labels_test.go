@@ -0,0 +1,141 @@
+package litebeam
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestShardLabels(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	labels, err := l.GetShardLabels(t.Context(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 0 {
+		t.Fatalf("expected no labels, got %v", labels)
+	}
+
+	if err := l.SetShardLabels(t.Context(), 1, map[string]string{"region": "eu", "tier": "hot"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetShardLabels(t.Context(), 2, map[string]string{"region": "eu"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetShardLabels(t.Context(), 3, map[string]string{"region": "us"}); err != nil {
+		t.Fatal(err)
+	}
+
+	labels, err = l.GetShardLabels(t.Context(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels["region"] != "eu" || labels["tier"] != "hot" {
+		t.Fatalf("unexpected labels %v", labels)
+	}
+
+	ids, err := l.ShardsWithLabels(t.Context(), map[string]string{"region": "eu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ids, []int{1, 2}) {
+		t.Fatalf("expected shards 1 and 2, got %v", ids)
+	}
+
+	drifts, err := l.CheckSchemaDrift(t.Context(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Fatalf("expected labels not to count as drift, got %+v", drifts)
+	}
+}
+
+func TestAssignToShardWithLabels(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for _, id := range []int{2, 4} {
+		if err := l.SetShardLabels(t.Context(), id, map[string]string{"region": "eu"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		id, err := l.AssignToShardWithLabels(t.Context(), key, map[string]string{"region": "eu"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != 2 && id != 4 {
+			t.Fatalf("key %s assigned to unlabelled shard %d", key, id)
+		}
+		again, err := l.AssignAmong(key, []int{4, 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again != id {
+			t.Fatalf("key %s: expected stable assignment %d, got %d", key, id, again)
+		}
+	}
+
+	if _, err := l.AssignToShardWithLabels(t.Context(), "a", map[string]string{"region": "us"}); !errors.Is(err, ErrNoMatchingShards) {
+		t.Fatalf("expected ErrNoMatchingShards, got %v", err)
+	}
+}
+
+func TestAssignToShardWithLabelsQuarantined(t *testing.T) {
+	l, err := NewLitebeam(Config{BasePath: t.TempDir(), TotalShards: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	eu := map[string]string{"region": "eu"}
+	for _, id := range []int{1, 2, 4} {
+		if err := l.SetShardLabels(t.Context(), id, eu); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	before := map[string]int{}
+	for _, key := range keys {
+		if before[key], err = l.AssignToShardWithLabels(t.Context(), key, eu); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := l.Quarantine(2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := l.ShardsWithLabels(t.Context(), eu); err != nil || !slices.Equal(ids, []int{1, 4}) {
+		t.Fatalf("expected ShardsWithLabels to list shards 1 and 4, got %v, %v", ids, err)
+	}
+	hitQuarantined := false
+	for _, key := range keys {
+		id, err := l.AssignToShardWithLabels(t.Context(), key, eu)
+		if id != before[key] {
+			t.Fatalf("key %s moved from shard %d to %d while shard 2 is quarantined", key, before[key], id)
+		}
+		if id == 2 {
+			hitQuarantined = true
+			if !errors.Is(err, ErrShardQuarantined) {
+				t.Fatalf("expected ErrShardQuarantined for key %s, got %v", key, err)
+			}
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !hitQuarantined {
+		t.Fatal("expected some key to map to the quarantined shard")
+	}
+}
@@ -0,0 +1,127 @@
+package litebeam
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFileLock(t *testing.T) {
+	path := t.TempDir() + "/test.lock"
+
+	lock, err := acquireFileLock(t.Context(), path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := acquireFileLock(ctx, path, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected second acquire to time out, got %v", err)
+	}
+
+	if err := lock.release(); err != nil {
+		t.Fatal(err)
+	}
+	lock, err = acquireFileLock(t.Context(), path, time.Minute)
+	if err != nil {
+		t.Fatalf("expected lock to be free after release: %v", err)
+	}
+	lock.release()
+}
+
+func TestFileLockStale(t *testing.T) {
+	path := t.TempDir() + "/test.lock"
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := acquireFileLock(t.Context(), path, time.Minute)
+	if err != nil {
+		t.Fatalf("expected stale lock to be taken over: %v", err)
+	}
+	lock.release()
+}
+
+func TestMigrateHoldsLock(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 1, Migrations: testMigrations})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	lock, err := l.lockMigrations(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.release()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := l.Migrate(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected Migrate to wait for the lock, got %v", err)
+	}
+	if _, err := l.MigrateWithOptions(t.Context(), MigrateOptions{DryRun: true}); err != nil {
+		t.Fatalf("expected dry run to skip the lock: %v", err)
+	}
+}
+
+func TestTokenLock(t *testing.T) {
+	path := t.TempDir() + "/test.lock"
+
+	lock, err := acquireTokenLock(t.Context(), path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := acquireTokenLock(ctx, path, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected second acquire to time out, got %v", err)
+	}
+	if err := lock.releaseToken(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected release to remove the lock file, got %v", err)
+	}
+}
+
+func TestTokenLockTakeOver(t *testing.T) {
+	path := t.TempDir() + "/test.lock"
+
+	first, err := acquireTokenLock(t.Context(), path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Let the first lock go stale, as if its process had hung.
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	second, err := acquireTokenLock(t.Context(), path, time.Minute)
+	if err != nil {
+		t.Fatalf("expected stale lock to be taken over: %v", err)
+	}
+	defer second.releaseToken()
+
+	if err := first.releaseToken(); err == nil {
+		t.Fatal("expected releasing a taken over lock to fail")
+	}
+	if lockToken(path) != second.token {
+		t.Fatal("expected the new holder's lock file to survive the old holder's release")
+	}
+
+	// A lock found stale but refreshed by the time it is moved aside is
+	// put back.
+	takeOverLock(path, "other", time.Minute)
+	if lockToken(path) != second.token {
+		t.Fatal("expected a live lock to be put back")
+	}
+}
@@ -0,0 +1,121 @@
+package litebeam
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	dir := t.TempDir() + "/"
+	if err := os.WriteFile(dir+"shard_9.db", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	l, err := NewLitebeam(Config{
+		BasePath:    dir,
+		TotalShards: 2,
+		Logger:      slog.New(slog.NewTextHandler(&buf, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if !strings.Contains(buf.String(), "level=WARN msg=\"shard files do not match configuration\"") {
+		t.Fatalf("expected consistency warning in logger output, got %q", buf.String())
+	}
+}
+
+func TestLoggerLevels(t *testing.T) {
+	var buf bytes.Buffer
+	conf := Config{
+		BasePath:    t.TempDir() + "/",
+		TotalShards: 2,
+		Logger:      slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+	l, err := NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.AssignToShard("item"); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	out := buf.String()
+	if strings.Count(out, "level=INFO msg=\"created shard\"") != 2 {
+		t.Fatalf("expected shard creation at info level, got %q", out)
+	}
+	if !strings.Contains(out, "level=DEBUG msg=\"assigned to shard\" shard=") {
+		t.Fatalf("expected assignment at debug level, got %q", out)
+	}
+	if strings.Contains(out, "item") {
+		t.Fatalf("expected the key not to be logged, got %q", out)
+	}
+
+	buf.Reset()
+	conf.Quiet = true
+	conf.BasePath = t.TempDir() + "/"
+	l, err = NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.AssignToShard("item"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected no output in quiet mode, got %q", buf.String())
+	}
+}
+
+func TestSlowQueryLogging(t *testing.T) {
+	var buf syncBuffer
+	l, err := NewLitebeam(Config{
+		BasePath:           t.TempDir(),
+		TotalShards:        1,
+		SlowQueryThreshold: time.Nanosecond,
+		Logger:             slog.New(slog.NewTextHandler(&buf, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s, err := l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := s.Reader.QueryRow("SELECT count(*) FROM generate_series(1, ?)", 100000).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `msg="slow query" shard=1 sql="SELECT count(*) FROM generate_series(1, ?)" digest=`) {
+		t.Fatalf("expected slow query to be logged, got %q", out)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent writers.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
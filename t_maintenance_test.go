@@ -0,0 +1,208 @@
+package litebeam
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCheckpointInterval(t *testing.T) {
+	dir := t.TempDir() + "/"
+	l, err := NewLitebeam(Config{
+		BasePath:           dir,
+		TotalShards:        1,
+		CheckpointInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if _, err := l.Shards[1].Writer.Exec("CREATE TABLE t (id INTEGER); INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		info, err := os.Stat(dir + "shard_1.db-wal")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected WAL to be truncated, still %d bytes", info.Size())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWALSizeThreshold(t *testing.T) {
+	dir := t.TempDir() + "/"
+	l, err := NewLitebeam(Config{
+		BasePath:         dir,
+		TotalShards:      1,
+		WALSizeThreshold: 1,
+		WALCheckInterval: 10 * time.Millisecond,
+		WALCheckpoint:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	events, cancel := l.Subscribe()
+	defer cancel()
+
+	if _, err := l.Shards[1].Writer.Exec("CREATE TABLE t (id INTEGER); INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-events:
+		if e.Type != EventWALOverThreshold || e.ShardID != 1 || e.Size <= 1 {
+			t.Fatalf("expected shard 1's WAL over threshold, got %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected an event for the WAL")
+	}
+	info, err := os.Stat(dir + "shard_1.db-wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Fatalf("expected WAL to be checkpointed, still %d bytes", info.Size())
+	}
+}
+
+func TestMaintenanceWindow(t *testing.T) {
+	at := func(h int) time.Time {
+		return time.Date(2025, 1, 1, h, 0, 0, 0, time.Local)
+	}
+
+	night := MaintenanceWindow{Start: 22 * time.Hour, End: 4 * time.Hour}
+	if !night.Contains(at(23)) || !night.Contains(at(2)) {
+		t.Fatal("expected wrapping window to contain 23:00 and 02:00")
+	}
+	if night.Contains(at(12)) {
+		t.Fatal("expected wrapping window not to contain 12:00")
+	}
+
+	day := MaintenanceWindow{Start: 9 * time.Hour, End: 17 * time.Hour}
+	if !day.Contains(at(9)) || day.Contains(at(17)) {
+		t.Fatal("expected window to include its start and exclude its end")
+	}
+
+	if !(MaintenanceWindow{}).Contains(at(5)) {
+		t.Fatal("expected zero window to always match")
+	}
+}
+
+func TestOptimizeInterval(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:         t.TempDir(),
+		TotalShards:      1,
+		OptimizeInterval: 10 * time.Millisecond,
+		OptimizeAnalyze:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	w := l.Shards[1].Writer
+	if _, err := w.Exec("CREATE TABLE t (id INTEGER); CREATE INDEX t_id ON t (id); INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var n int
+		err := w.QueryRow("SELECT count(*) FROM sqlite_stat1").Scan(&n)
+		if err == nil && n > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected ANALYZE to populate sqlite_stat1: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIncrementalVacuum(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:       t.TempDir(),
+		TotalShards:    1,
+		AutoVacuum:     AutoVacuumIncremental,
+		VacuumInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	w := l.Shards[1].Writer
+	stmts := []string{
+		"CREATE TABLE t (data BLOB)",
+		"INSERT INTO t SELECT randomblob(4096) FROM generate_series(1, 100)",
+		"DELETE FROM t",
+	}
+	for _, stmt := range stmts {
+		if _, err := w.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var free int
+		if err := w.QueryRow("PRAGMA freelist_count").Scan(&free); err != nil {
+			t.Fatal(err)
+		}
+		if free == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected freelist to be vacuumed, still %d pages", free)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOptimizeClosedShards(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:        t.TempDir(),
+		TotalShards:     2,
+		MaxOpenShards:   1,
+		OptimizeAnalyze: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s, err := l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("CREATE TABLE t (id INTEGER); CREATE INDEX t_id ON t (id); INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.GetShard(2); err != nil {
+		t.Fatal(err)
+	}
+	if l.Shards[1] != nil {
+		t.Fatal("expected shard 1 to be closed")
+	}
+
+	l.optimizeAll()
+
+	s, err = l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := s.Writer.QueryRow("SELECT count(*) FROM sqlite_stat1").Scan(&n); err != nil || n == 0 {
+		t.Fatalf("expected ANALYZE to reach closed shard 1, got %d rows: %v", n, err)
+	}
+}
@@ -0,0 +1,70 @@
+package litebeam
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ncruces/go-sqlite3/driver"
+)
+
+func TestExportMerged(t *testing.T) {
+	l, err := NewLitebeam(Config{BasePath: t.TempDir() + "/", TotalShards: 3, InitSchemaFunc: itemsSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for id := 1; id <= 3; id++ {
+		s, err := l.GetShard(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Every shard uses the same keys, which must not clash when merged.
+		for range id {
+			if _, err := s.Writer.Exec("INSERT INTO items (id) VALUES ((SELECT COALESCE(MAX(id), 0) + 1 FROM items))"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	dst := filepath.Join(t.TempDir(), "merged.db")
+	if err := l.ExportMerged(t.Context(), dst, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := driver.Open("file:" + dst + "?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT shard_id, count(*) FROM items GROUP BY shard_id ORDER BY shard_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	want := 1
+	for rows.Next() {
+		var id, n int
+		if err := rows.Scan(&id, &n); err != nil {
+			t.Fatal(err)
+		}
+		if id != want || n != want {
+			t.Fatalf("expected shard %d to have %d rows, got shard %d with %d", want, want, id, n)
+		}
+		want++
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want != 4 {
+		t.Fatalf("expected rows from 3 shards, got %d", want-1)
+	}
+
+	var tables int
+	if err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'schema_migrations'").Scan(&tables); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Fatal("expected litebeam's own tables to be left out")
+	}
+}
@@ -0,0 +1,134 @@
+package litebeam
+
+import (
+	"expvar"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	dir := t.TempDir() + "/"
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 3, MaxOpenShards: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if err := os.WriteFile(dir+"shard_3.db", []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for id := 1; id <= 3; id++ {
+		l.GetShard(id)
+	}
+	if _, err := l.AssignToShard("item"); err != nil {
+		t.Fatal(err)
+	}
+
+	m := l.Metrics()
+	if m.ShardOpens != 2 || m.ShardsCreated != 2 || m.OpenErrors != 1 {
+		t.Fatalf("expected 2 opens, 2 created and 1 error, got %+v", m)
+	}
+	if m.Assignments != 1 || m.OpenShards != 2 {
+		t.Fatalf("expected 1 assignment and 2 open shards, got %+v", m)
+	}
+	if len(m.FileBytes) != 3 || m.FileBytes[1] == 0 {
+		t.Fatalf("expected sizes of 3 files, got %v", m.FileBytes)
+	}
+	if h := m.Handles[1]; len(m.Handles) != 2 || h.Pools != 2 || h.InUse+h.Idle == 0 {
+		t.Fatalf("expected 2 pools with open connections on each of 2 shards, got %v", m.Handles)
+	}
+}
+
+func TestExpvar(t *testing.T) {
+	conf := Config{BasePath: t.TempDir(), TotalShards: 2, ExpvarName: "litebeam_test"}
+	l, err := NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.AssignToShard("item"); err != nil {
+		t.Fatal(err)
+	}
+	if got := expvar.Get("litebeam_test").String(); !strings.Contains(got, `"assignments":1`) {
+		t.Fatalf("expected published metrics, got %s", got)
+	}
+	if _, err := NewLitebeam(conf); err == nil {
+		t.Fatal("expected a second Litebeam to be refused the same name")
+	}
+
+	l.Close()
+	l, err = NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if got := expvar.Get("litebeam_test").String(); !strings.Contains(got, `"assignments":0`) {
+		t.Fatalf("expected metrics of the new Litebeam, got %s", got)
+	}
+}
+
+func TestGetShardSize(t *testing.T) {
+	l, err := NewLitebeam(Config{BasePath: t.TempDir(), TotalShards: 2, MaxOpenShards: 2, InitSchemaFunc: itemsSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if size, err := l.GetShardSize(2); err != nil || size != 0 {
+		t.Fatalf("expected size 0 before shard 2 exists, got %d, %v", size, err)
+	}
+	s, err := l.GetShard(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := l.GetShardSize(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("INSERT INTO items (id) SELECT value FROM generate_series(1, 1000)"); err != nil {
+		t.Fatal(err)
+	}
+	after, err := l.GetShardSize(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after <= before {
+		t.Fatalf("expected the WAL to count towards the size, got %d then %d", before, after)
+	}
+	if _, err := l.GetShardSize(3); err == nil {
+		t.Fatal("expected error for out of range shard")
+	}
+}
+
+func TestInstrumentQueries(t *testing.T) {
+	sink := newRecordingSink()
+	l, err := NewLitebeam(Config{BasePath: t.TempDir(), TotalShards: 2, InstrumentQueries: true, MetricsSink: sink})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	db := l.Shards[1].Writer
+	if _, err := db.Exec("CREATE TABLE t (v INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO t VALUES (?)", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO missing VALUES (?)", 1); err == nil {
+		t.Fatal("expected an error inserting into a missing table")
+	}
+
+	q := l.Metrics().Queries[1]
+	if q.Count < 3 || q.Errors != 1 {
+		t.Fatalf("expected at least 3 statements and 1 error on shard 1, got %+v", q)
+	}
+	if len(q.Buckets) != len(QueryLatencyBuckets) || q.Buckets[len(q.Buckets)-1] == 0 {
+		t.Fatalf("expected a filled latency histogram, got %v", q.Buckets)
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if sink.counters["query.errors"] != 1 || sink.timings["query"] == 0 {
+		t.Fatalf("expected query metrics in the sink, got %v %v", sink.counters, sink.timings)
+	}
+}
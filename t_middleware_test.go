@@ -0,0 +1,85 @@
+package litebeam
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	errDenied := errors.New("denied")
+	var (
+		mu   sync.Mutex
+		seen []Query
+	)
+	record := func(next QueryHandler) QueryHandler {
+		return func(ctx context.Context, q Query) error {
+			mu.Lock()
+			seen = append(seen, q)
+			mu.Unlock()
+			return next(ctx, q)
+		}
+	}
+	deny := func(next QueryHandler) QueryHandler {
+		return func(ctx context.Context, q Query) error {
+			if strings.HasPrefix(q.SQL, "DROP") {
+				return errDenied
+			}
+			return next(ctx, q)
+		}
+	}
+
+	l, err := NewLitebeam(Config{
+		BasePath:    t.TempDir(),
+		TotalShards: 2,
+		Middleware:  []Middleware{record, deny},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := l.Shards[2]
+	if _, err := s.Writer.ExecContext(t.Context(), "CREATE TABLE t (v INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.ExecContext(t.Context(), "INSERT INTO t VALUES (?)", 7); err != nil {
+		t.Fatal(err)
+	}
+	var v int
+	if err := s.Writer.QueryRowContext(t.Context(), "SELECT v FROM t WHERE v = ?", 7).Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v != 7 {
+		t.Fatalf("expected 7, got %d", v)
+	}
+	if _, err := s.Writer.ExecContext(t.Context(), "DROP TABLE t"); !errors.Is(err, errDenied) {
+		t.Fatalf("expected errDenied, got %v", err)
+	}
+	if err := s.Writer.QueryRowContext(t.Context(), "SELECT count(*) FROM t").Scan(&v); err != nil {
+		t.Fatalf("table dropped despite middleware: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var insert, query *Query
+	for i, q := range seen {
+		if q.ShardID != 2 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(q.SQL, "INSERT"):
+			insert = &seen[i]
+		case strings.HasPrefix(q.SQL, "SELECT v"):
+			query = &seen[i]
+		}
+	}
+	if insert == nil || !insert.Exec || len(insert.Args) != 1 {
+		t.Fatalf("middleware did not see the insert: %+v", insert)
+	}
+	if query == nil || query.Exec {
+		t.Fatalf("middleware did not see the query: %+v", query)
+	}
+}
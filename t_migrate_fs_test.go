@@ -0,0 +1,87 @@
+package litebeam
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrationsFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD COLUMN email TEXT;")},
+		"migrations/0002_add_email.down.sql":    {Data: []byte("ALTER TABLE users DROP COLUMN email;")},
+		"migrations/0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id TEXT PRIMARY KEY);")},
+		"migrations/0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"migrations/README.md":                  {Data: []byte("ignored")},
+	}
+
+	migrations, err := MigrationsFromFS(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("expected 2 migrations, got %d", len(migrations))
+	}
+	if migrations[0].Version != 1 || migrations[0].Name != "create_users" || migrations[0].Down != "DROP TABLE users;" {
+		t.Fatalf("unexpected first migration: %+v", migrations[0])
+	}
+
+	l, err := NewLitebeam(Config{
+		BasePath:    existingShards(t, 2),
+		TotalShards: 2,
+		Migrations:  migrations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if _, err := l.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Shards[2].Writer.Exec("INSERT INTO users (id, email) VALUES ('a', 'a@example.com')"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrationsFromFSMismatchedNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/1_a.up.sql":   {Data: []byte("SELECT 1")},
+		"m/1_b.down.sql": {Data: []byte("SELECT 1")},
+	}
+	if _, err := MigrationsFromFS(fsys, "m"); err == nil {
+		t.Fatal("expected error for mismatched migration names")
+	}
+}
+
+func TestSchemaFS(t *testing.T) {
+	dir := t.TempDir()
+	fsys := fstest.MapFS{
+		"0001_users.sql": {Data: []byte("CREATE TABLE users (id TEXT PRIMARY KEY);")},
+	}
+
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 2, SchemaFS: fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Shards[1].Writer.Exec("INSERT INTO users (id) VALUES ('a')"); err != nil {
+		t.Fatalf("expected new shard to be created with the schema: %v", err)
+	}
+	l.Close()
+
+	fsys["0002_email.sql"] = &fstest.MapFile{Data: []byte("ALTER TABLE users ADD COLUMN email TEXT;")}
+	l, err = NewLitebeam(Config{BasePath: dir, TotalShards: 2, SchemaFS: fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if _, err := l.Shards[1].Writer.Exec("UPDATE users SET email = 'a@example.com'"); err == nil {
+		t.Fatal("expected existing shard to wait for Migrate")
+	}
+	if _, err := l.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Shards[1].Writer.Exec("UPDATE users SET email = 'a@example.com'"); err != nil {
+		t.Fatalf("expected migrated shard to have email column: %v", err)
+	}
+}
@@ -0,0 +1,368 @@
+package litebeam
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+var testMigrations = []Migration{
+	{Version: 2, Name: "add email", Up: "ALTER TABLE users ADD COLUMN email TEXT", Down: "ALTER TABLE users DROP COLUMN email"},
+	{Version: 1, Name: "create users", Up: "CREATE TABLE users (id TEXT PRIMARY KEY)", Down: "DROP TABLE users"},
+}
+
+// existingShards creates n empty shards in a new directory, so migrations
+// configured afterwards are not applied at creation.
+func existingShards(t *testing.T, n int) string {
+	t.Helper()
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: n})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestMigrate(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    existingShards(t, 3),
+		TotalShards: 3,
+		Migrations:  testMigrations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	results, err := l.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.From != 0 || r.To != 2 {
+			t.Fatalf("shard %d: expected 0 -> 2, got %d -> %d", r.ShardID, r.From, r.To)
+		}
+	}
+
+	if _, err := l.Shards[1].Writer.Exec("INSERT INTO users (id, email) VALUES ('a', 'a@example.com')"); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err = l.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.From != 2 || r.To != 2 {
+			t.Fatalf("shard %d: expected no changes, got %d -> %d", r.ShardID, r.From, r.To)
+		}
+	}
+}
+
+func TestMigrateFailureRollsBack(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    existingShards(t, 2),
+		TotalShards: 2,
+		Migrations: []Migration{
+			{Version: 1, Name: "create users", Up: "CREATE TABLE users (id TEXT)"},
+			{Version: 2, Name: "broken", Up: "CREATE TABLE t (id TEXT); SELECT * FROM missing"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	results, err := l.Migrate(t.Context())
+	if err == nil {
+		t.Fatal("expected migration error")
+	}
+	if len(results) != 1 || results[0].To != 1 {
+		t.Fatalf("expected shard 1 to stop at version 1, got %+v", results)
+	}
+
+	var n int
+	if err := l.Shards[1].Reader.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 't'").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatal("expected failed migration to be rolled back")
+	}
+}
+
+func TestMigrateStopsOnOpenFailure(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    existingShards(t, 3),
+		TotalShards: 3,
+		Migrations:  testMigrations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.Quarantine(1, errors.New("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := l.Migrate(t.Context())
+	if !errors.Is(err, ErrShardQuarantined) {
+		t.Fatalf("expected ErrShardQuarantined, got %v", err)
+	}
+	if len(results) != 1 || results[0].ShardID != 1 {
+		t.Fatalf("expected to stop after shard 1, got %+v", results)
+	}
+}
+
+func TestMigrateDuplicateVersions(t *testing.T) {
+	_, err := sortMigrations([]Migration{{Version: 1}, {Version: 1}})
+	if err == nil {
+		t.Fatal("expected duplicate version error")
+	}
+}
+
+func TestMigrateNewShards(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    t.TempDir(),
+		TotalShards: 2,
+		Migrations:  testMigrations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if _, err := l.Shards[2].Writer.Exec("INSERT INTO users (id, email) VALUES ('a', 'a@example.com')"); err != nil {
+		t.Fatalf("expected new shard to be migrated at creation: %v", err)
+	}
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    existingShards(t, 2),
+		TotalShards: 2,
+		Migrations:  testMigrations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	results, err := l.MigrateWithOptions(t.Context(), MigrateOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.From != 0 || r.To != 0 || len(r.Pending) != 2 || r.Pending[0].Version != 1 {
+			t.Fatalf("unexpected dry run result: %+v", r)
+		}
+	}
+
+	var n int
+	if err := l.Shards[1].Reader.QueryRow("SELECT count(*) FROM sqlite_master").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected dry run to leave the shard untouched, found %d objects", n)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    t.TempDir(),
+		TotalShards: 3,
+		Migrations:  testMigrations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	results, err := l.Rollback(t.Context(), 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.From != 2 || r.To != 1 {
+			t.Fatalf("shard %d: expected 2 -> 1, got %d -> %d", r.ShardID, r.From, r.To)
+		}
+	}
+	if _, err := l.Shards[1].Writer.Exec("INSERT INTO users (id, email) VALUES ('a', 'b')"); err == nil {
+		t.Fatal("expected email column to be dropped on shard 1")
+	}
+	if _, err := l.Shards[2].Writer.Exec("INSERT INTO users (id, email) VALUES ('a', 'b')"); err != nil {
+		t.Fatalf("expected shard 2 to be untouched: %v", err)
+	}
+
+	// Leave only version 2 configured, so shards at version 1 have nothing
+	// to roll back with while shard 2 still does.
+	l.Config.Migrations = []Migration{testMigrations[0]}
+	results, err = l.Rollback(t.Context())
+	if err == nil {
+		t.Fatal("expected error for shards without a matching down migration")
+	}
+	if len(results) != 3 || results[0].Err == nil || results[1].Err != nil || results[2].Err == nil {
+		t.Fatalf("expected shards 1 and 3 to fail and shard 2 to succeed, got %+v", results)
+	}
+}
+
+func TestMigrateConcurrentContinueOnError(t *testing.T) {
+	dir := existingShards(t, 4)
+
+	l, err := NewLitebeam(Config{
+		BasePath:    dir,
+		TotalShards: 4,
+		Migrations: []Migration{{
+			Version: 1,
+			Name:    "create_items",
+			Up:      "CREATE TABLE items (id INTEGER PRIMARY KEY)",
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Make shard 2 fail by creating the table ahead of the migration.
+	s, err := l.GetShard(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := l.MigrateWithOptions(t.Context(), MigrateOptions{Concurrency: 3, ContinueOnError: true})
+	if err == nil {
+		t.Fatal("expected an error for shard 2")
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected a result for every shard, got %+v", results)
+	}
+	for i, r := range results {
+		if r.ShardID != i+1 {
+			t.Fatalf("expected results in shard order, got %+v", results)
+		}
+		if (r.Err != nil) != (r.ShardID == 2) {
+			t.Fatalf("shard %d: unexpected error %v", r.ShardID, r.Err)
+		}
+		if r.Err == nil && r.To != 1 {
+			t.Fatalf("shard %d: expected version 1, got %d", r.ShardID, r.To)
+		}
+	}
+}
+
+func TestGetSchemaVersions(t *testing.T) {
+	dir := existingShards(t, 3)
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 3, Migrations: testMigrations})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	versions, err := l.GetSchemaVersions(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || versions[1] != 0 {
+		t.Fatalf("expected unmigrated shards at version 0, got %v", versions)
+	}
+
+	if _, err := l.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Rollback(t.Context(), 3); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err = l.GetSchemaVersions(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if versions[1] != 2 || versions[2] != 2 || versions[3] != 1 {
+		t.Fatalf("unexpected versions %v", versions)
+	}
+}
+
+func TestGetSchemaVersionsPartial(t *testing.T) {
+	l, err := NewLitebeam(Config{BasePath: existingShards(t, 3), TotalShards: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.Quarantine(2, errors.New("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := l.GetSchemaVersions(t.Context())
+	if !errors.Is(err, ErrShardQuarantined) {
+		t.Fatalf("expected ErrShardQuarantined, got %v", err)
+	}
+	if len(versions) != 2 || versions[1] != 0 || versions[3] != 0 {
+		t.Fatalf("expected the versions of shards 1 and 3, got %v", versions)
+	}
+}
+
+func TestAssignToShardSchemaStale(t *testing.T) {
+	dir := existingShards(t, 1)
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 1, Migrations: testMigrations, MinSchemaVersion: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	id, err := l.AssignToShard("item")
+	if !errors.Is(err, ErrSchemaStale) || id != 1 {
+		t.Fatalf("expected shard 1 with ErrSchemaStale, got %d, %v", id, err)
+	}
+
+	if _, err := l.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.AssignToShard("item"); err != nil {
+		t.Fatalf("expected migrated shard to be assignable: %v", err)
+	}
+
+	if _, err := l.Rollback(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.AssignToShard("item"); !errors.Is(err, ErrSchemaStale) {
+		t.Fatalf("expected ErrSchemaStale after rollback, got %v", err)
+	}
+}
+
+func TestAssignToShardSchemaStaleAfterRestore(t *testing.T) {
+	dir := existingShards(t, 1)
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 1, Migrations: testMigrations, MinSchemaVersion: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Back up the shard before it is migrated.
+	old := filepath.Join(t.TempDir(), "shard_1.db")
+	if err := l.BackupShard(t.Context(), 1, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.AssignToShard("item"); err != nil {
+		t.Fatalf("expected migrated shard to be assignable: %v", err)
+	}
+
+	if err := l.RestoreShard(t.Context(), 1, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.AssignToShard("item"); !errors.Is(err, ErrSchemaStale) {
+		t.Fatalf("expected ErrSchemaStale after restoring an older backup, got %v", err)
+	}
+}
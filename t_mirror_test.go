@@ -0,0 +1,145 @@
+package litebeam
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMirror(t *testing.T) {
+	dir, mirror := t.TempDir(), t.TempDir()
+	conf := Config{
+		BasePath:       dir,
+		TotalShards:    2,
+		InitSchemaFunc: itemsSchema,
+		MirrorPath:     mirror,
+		MirrorInterval: time.Hour,
+	}
+	l, err := NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("INSERT INTO items VALUES (7)"); err != nil {
+		t.Fatal(err)
+	}
+
+	l.mirrorAll()
+	for id := 1; id <= 2; id++ {
+		if l.Config.mirrorStale(id) {
+			t.Fatalf("expected shard %d to be mirrored", id)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt shard 1; reopening fails over to the mirror.
+	path := filepath.Join(dir, "shard_1.db")
+	if err := os.WriteFile(path, []byte("definitely not sqlite"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err = NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s, err = l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	if err := s.Reader.QueryRow("SELECT id FROM items").Scan(&id); err != nil || id != 7 {
+		t.Fatalf("expected the mirrored row, got %d, %v", id, err)
+	}
+	if _, err := os.Stat(path + corruptSuffix); err != nil {
+		t.Fatalf("expected the corrupt file to be kept: %v", err)
+	}
+}
+
+func TestMirrorLazy(t *testing.T) {
+	dir, mirror := t.TempDir(), t.TempDir()
+	l, err := NewLitebeam(Config{
+		BasePath:       dir,
+		TotalShards:    3,
+		MaxOpenShards:  1,
+		InitSchemaFunc: itemsSchema,
+		MirrorPath:     mirror,
+		MirrorInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Shard 1 is written and closed by opening shard 2; shard 3 has no file.
+	for _, id := range []int{1, 2} {
+		s, err := l.GetShard(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Writer.Exec("INSERT INTO items VALUES (?)", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now()
+	l.mirrorAll()
+	if _, err := os.Stat(filepath.Join(dir, "shard_3.db")); !os.IsNotExist(err) {
+		t.Fatalf("expected shard 3 not to be created, got %v", err)
+	}
+	if _, ok := l.Shards[1]; ok {
+		t.Fatal("expected mirroring not to open shard 1")
+	}
+	for id := 1; id <= 2; id++ {
+		info, err := os.Stat(l.Config.mirrorPath(id))
+		if err != nil {
+			t.Fatalf("expected shard %d to be mirrored: %v", id, err)
+		}
+		if info.ModTime().Before(start.Truncate(time.Second)) || info.ModTime().After(time.Now()) {
+			t.Fatalf("expected the mirror of shard %d to be dated to the copy start, got %v", id, info.ModTime())
+		}
+	}
+	if _, err := os.Stat(l.Config.mirrorPath(3)); !os.IsNotExist(err) {
+		t.Fatalf("expected no mirror of shard 3, got %v", err)
+	}
+}
+
+func TestMirrorAbsoluteShardPaths(t *testing.T) {
+	dir, mirror := t.TempDir(), t.TempDir()
+	for _, sub := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l, err := NewLitebeam(Config{
+		BasePath:    dir,
+		TotalShards: 2,
+		ShardPathFunc: func(id int) string {
+			return filepath.Join(dir, string(rune('a'+id-1)), "data.db")
+		},
+		InitSchemaFunc: itemsSchema,
+		MirrorPath:     mirror,
+		MirrorInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	l.mirrorAll()
+	for id := 1; id <= 2; id++ {
+		if l.Config.mirrorStale(id) {
+			t.Fatalf("expected shard %d to be mirrored", id)
+		}
+		if _, err := os.Stat(filepath.Join(mirror, fmt.Sprintf("shard_%d.db", id))); err != nil {
+			t.Fatalf("expected shard %d's own mirror file: %v", id, err)
+		}
+	}
+}
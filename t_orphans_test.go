@@ -0,0 +1,50 @@
+package litebeam
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCleanOrphans(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	l, err = NewLitebeam(Config{BasePath: dir, TotalShards: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	orphans, err := l.FindOrphans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 2 {
+		t.Fatalf("expected 2 orphans, got %v", orphans)
+	}
+
+	removed, err := l.CleanOrphans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("expected 2 removed orphans, got %v", removed)
+	}
+	for _, p := range removed {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed", p)
+		}
+	}
+
+	orphans, err = l.FindOrphans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 0 {
+		t.Fatalf("expected no orphans after cleaning, got %v", orphans)
+	}
+}
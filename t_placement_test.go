@@ -0,0 +1,119 @@
+package litebeam
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBasePathsRoundRobin(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: a, BasePaths: []string{b}, TotalShards: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	for id, dir := range map[int]string{1: a, 2: b, 3: a, 4: b} {
+		if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("shard_%d.db", id))); err != nil {
+			t.Fatalf("expected shard %d in %s: %v", id, dir, err)
+		}
+	}
+
+	// A shard moved to another base path is still found there.
+	if err := os.Rename(filepath.Join(a, "shard_1.db"), filepath.Join(b, "shard_1.db")); err != nil {
+		t.Fatal(err)
+	}
+	l, err = NewLitebeam(Config{BasePath: a, BasePaths: []string{b}, TotalShards: 4, ConsistencyPolicy: ConsistencyFail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := os.Stat(filepath.Join(a, "shard_1.db")); !os.IsNotExist(err) {
+		t.Fatal("expected shard 1 not to be recreated in the first base path")
+	}
+}
+
+func TestBasePathsMostFree(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: a, BasePaths: []string{b}, TotalShards: 2, Placement: PlaceMostFree})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for _, name := range []string{"shard_1.db", "shard_2.db"} {
+		_, errA := os.Stat(filepath.Join(a, name))
+		_, errB := os.Stat(filepath.Join(b, name))
+		if (errA == nil) == (errB == nil) {
+			t.Fatalf("expected %s in exactly one base path", name)
+		}
+	}
+}
+
+func TestBasePathsMissingVolume(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	conf := Config{BasePath: a, BasePaths: []string{b}, TotalShards: 2}
+	l, err := NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	// The volume holding shard 2 goes missing.
+	if err := os.Remove(filepath.Join(b, "shard_2.db")); err != nil {
+		t.Fatal(err)
+	}
+	conf.MaxOpenShards = 2
+	l, err = NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.GetShard(2); !errors.Is(err, ErrShardMissing) {
+		t.Fatalf("expected ErrShardMissing, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(a, "shard_2.db")); !os.IsNotExist(err) {
+		t.Fatal("expected shard 2 not to be recreated in another base path")
+	}
+}
+
+func TestBasePathsEmpty(t *testing.T) {
+	_, err := NewLitebeam(Config{BasePath: t.TempDir(), BasePaths: []string{""}, TotalShards: 2})
+	if err == nil {
+		t.Fatal("expected an empty base path to be rejected")
+	}
+	_, err = NewLitebeam(Config{BasePath: t.TempDir(), Tiers: map[string]string{"cold": ""}, TotalShards: 2})
+	if err == nil {
+		t.Fatal("expected an empty tier path to be rejected")
+	}
+}
+
+func TestBasePathsRepair(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	conf := Config{BasePath: a, BasePaths: []string{b}, TotalShards: 2}
+	l, err := NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	path := filepath.Join(b, "shard_2.db")
+	if err := os.WriteFile(path, []byte("definitely not sqlite"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	conf.ConsistencyPolicy = ConsistencyRepair
+	l, err = NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.GetShard(2); err != nil {
+		t.Fatalf("expected shard 2 to be recreated, got %v", err)
+	}
+	if _, err := os.Stat(path + corruptSuffix); err != nil {
+		t.Fatalf("expected the unreadable file to be kept: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package litebeam
+
+import "testing"
+
+func TestPoolConfig(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    t.TempDir(),
+		TotalShards: 2,
+		Pools: ShardPoolConfig{
+			Reader: PoolConfig{MaxOpenConns: 4},
+		},
+		ShardPools: map[int]ShardPoolConfig{
+			2: {Reader: PoolConfig{MaxOpenConns: 8}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if got := l.Shards[1].Writer.Stats().MaxOpenConnections; got != 1 {
+		t.Fatalf("expected writer max open conns 1, got %d", got)
+	}
+	if got := l.Shards[1].Reader.Stats().MaxOpenConnections; got != 4 {
+		t.Fatalf("expected reader max open conns 4, got %d", got)
+	}
+	if got := l.Shards[2].Reader.Stats().MaxOpenConnections; got != 8 {
+		t.Fatalf("expected overridden reader max open conns 8, got %d", got)
+	}
+}
+
+func TestReaderPools(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    t.TempDir(),
+		TotalShards: 1,
+		ReaderPools: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := l.Shards[1]
+	if len(s.Readers) != 3 {
+		t.Fatalf("expected 3 reader pools, got %d", len(s.Readers))
+	}
+	if s.Reader != s.Readers[0] {
+		t.Fatal("expected Reader to be the first reader pool")
+	}
+
+	seen := map[any]bool{}
+	for range 3 {
+		seen[s.NextReader()] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected NextReader to visit 3 pools, got %d", len(seen))
+	}
+}
@@ -0,0 +1,129 @@
+package litebeam
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAutoQuarantine(t *testing.T) {
+	dir := t.TempDir() + "/"
+	var events []int
+	l, err := NewLitebeam(Config{
+		BasePath:       dir,
+		TotalShards:    4,
+		MaxOpenShards:  4,
+		AutoQuarantine: true,
+		OnQuarantine: func(shardID int, reason error) {
+			events = append(events, shardID)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if err := os.WriteFile(dir+"shard_3.db", []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l.QuickCheckAll(t.Context(), 2)
+
+	if q := l.Quarantined(); len(q) != 1 || !errors.Is(q[3], ErrShardCorrupt) {
+		t.Fatalf("expected shard 3 quarantined as corrupt, got %v", q)
+	}
+	if len(events) != 1 || events[0] != 3 {
+		t.Fatalf("expected one quarantine event for shard 3, got %v", events)
+	}
+	if _, err := l.GetShard(3); !errors.Is(err, ErrShardQuarantined) {
+		t.Fatalf("expected ErrShardQuarantined, got %v", err)
+	}
+
+	var visited []int
+	if err := l.RangeShards(func(id int, s *Shard) error {
+		visited = append(visited, id)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(visited) != "[1 2 4]" {
+		t.Fatalf("expected quarantined shard to be skipped, visited %v", visited)
+	}
+
+	for i := 0; ; i++ {
+		base := fmt.Sprintf("item-%d", i)
+		id, err := l.AssignToShard(base)
+		if id != 3 {
+			continue
+		}
+		if !errors.Is(err, ErrShardQuarantined) {
+			t.Fatalf("expected ErrShardQuarantined for %s, got %v", base, err)
+		}
+		break
+	}
+
+	l.Unquarantine(3)
+	if _, err := l.GetShard(3); !errors.Is(err, ErrShardCorrupt) {
+		t.Fatalf("expected shard 3 to be back in service and corrupt, got %v", err)
+	}
+}
+
+func TestAutoRestore(t *testing.T) {
+	dir := t.TempDir() + "/"
+	backups := t.TempDir()
+	conf := Config{
+		BasePath:       dir,
+		TotalShards:    2,
+		MaxOpenShards:  2,
+		InitSchemaFunc: itemsSchema,
+		AutoQuarantine: true,
+		AutoRestore:    true,
+		BackupDir:      backups,
+	}
+	l, err := NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := l.GetShard(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("INSERT INTO items (id) VALUES (1), (2)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.BackupAll(t.Context(), filepath.Join(backups, "20240101T000000Z")); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(dir+"shard_2.db", []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err = NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	results := l.QuickCheckAll(t.Context(), 1)
+	if !errors.Is(results[2], ErrShardCorrupt) {
+		t.Fatalf("expected shard 2 to be found corrupt, got %v", results[2])
+	}
+	if q := l.Quarantined(); len(q) != 0 {
+		t.Fatalf("expected restored shard to leave quarantine, got %v", q)
+	}
+	s, err = l.GetShard(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := s.Reader.QueryRow("SELECT count(*) FROM items").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 restored rows, got %d", n)
+	}
+}
@@ -0,0 +1,126 @@
+package litebeam
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRangeShards(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:      t.TempDir(),
+		TotalShards:   5,
+		MaxOpenShards: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var seen []int
+	err = l.RangeShards(func(id int, s *Shard) error {
+		seen = append(seen, id)
+		return s.Writer.Ping()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 5 || seen[0] != 1 || seen[4] != 5 {
+		t.Fatalf("expected shards 1..5 in order, got %v", seen)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = l.RangeShards(func(id int, s *Shard) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Fatalf("expected to stop after first error, got %v after %d calls", err, calls)
+	}
+}
+
+func TestForEachShard(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:      t.TempDir(),
+		TotalShards:   6,
+		MaxOpenShards: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.Quarantine(6, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu       sync.Mutex
+		seen     = map[int]bool{}
+		inFlight atomic.Int32
+		maxSeen  atomic.Int32
+	)
+	errOdd := errors.New("odd shard")
+	err = l.ForEachShard(t.Context(), 4, func(id int, s *Shard) error {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		if n > maxSeen.Load() {
+			maxSeen.Store(n)
+		}
+		mu.Lock()
+		seen[id] = true
+		mu.Unlock()
+		if err := s.Writer.Ping(); err != nil {
+			return err
+		}
+		if id%2 == 1 {
+			return errOdd
+		}
+		return nil
+	})
+	if len(seen) != 5 || seen[6] {
+		t.Fatalf("expected shards 1..5 to be visited, got %v", seen)
+	}
+	if !errors.Is(err, errOdd) || !strings.Contains(err.Error(), "shard 5: odd shard") || strings.Contains(err.Error(), "shard 2") {
+		t.Fatalf("expected errors from shards 1, 3 and 5, got %v", err)
+	}
+	if maxSeen.Load() > 3 {
+		t.Fatalf("expected at most MaxOpenShards calls at once, got %d", maxSeen.Load())
+	}
+}
+
+func TestForEachShardWaitsForRoom(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:      t.TempDir(),
+		TotalShards:   4,
+		MaxOpenShards: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Leases held elsewhere take both slots for a while.
+	for id := 1; id <= 2; id++ {
+		_, release, err := l.AcquireShard(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.AfterFunc(100*time.Millisecond, release)
+	}
+
+	var calls atomic.Int32
+	err = l.ForEachShard(t.Context(), 4, func(id int, s *Shard) error {
+		calls.Add(1)
+		return s.Writer.Ping()
+	})
+	if err != nil {
+		t.Fatalf("expected ForEachShard to wait for room, got %v", err)
+	}
+	if calls.Load() != 4 {
+		t.Fatalf("expected 4 calls, got %d", calls.Load())
+	}
+}
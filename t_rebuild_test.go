@@ -0,0 +1,154 @@
+package litebeam
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestRebuildTable(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{
+		BasePath:    dir,
+		TotalShards: 3,
+		InitSchemaFunc: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				CREATE TABLE IF NOT EXISTS items (id INTEGER PRIMARY KEY, name TEXT, qty TEXT);
+				CREATE INDEX IF NOT EXISTS items_name ON items (name);
+				INSERT OR IGNORE INTO items VALUES (1, 'a', '5'), (2, 'b', '7');`)
+			return err
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var progress []ShardProgress
+	errs := l.RebuildTable(t.Context(), TableRebuild{
+		Table:       "items",
+		Columns:     "id INTEGER PRIMARY KEY, name TEXT NOT NULL, qty INTEGER NOT NULL CHECK (qty >= 0)",
+		Concurrency: 2,
+		Progress:    func(p ShardProgress) { progress = append(progress, p) },
+	})
+	for id, err := range errs {
+		if err != nil {
+			t.Fatalf("shard %d: %v", id, err)
+		}
+	}
+	if len(progress) != 3 || progress[2].Done != 3 || progress[2].Total != 3 {
+		t.Fatalf("unexpected progress %+v", progress)
+	}
+
+	err = l.RangeShards(func(id int, s *Shard) error {
+		var sum int
+		if err := s.Writer.QueryRow("SELECT sum(qty) FROM items").Scan(&sum); err != nil {
+			return err
+		}
+		if sum != 12 {
+			t.Fatalf("shard %d: expected rows to be copied, got sum %d", id, sum)
+		}
+		var schema string
+		if err := s.Writer.QueryRow("SELECT sql FROM sqlite_master WHERE name = 'items'").Scan(&schema); err != nil {
+			return err
+		}
+		if !strings.Contains(schema, "CHECK") {
+			t.Fatalf("shard %d: expected new schema, got %s", id, schema)
+		}
+		var indexes int
+		if err := s.Writer.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'items_name'").Scan(&indexes); err != nil {
+			return err
+		}
+		if indexes != 1 {
+			t.Fatalf("shard %d: expected index to be recreated", id)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRebuildTableFailure(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{
+		BasePath:    dir,
+		TotalShards: 1,
+		InitSchemaFunc: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				CREATE TABLE IF NOT EXISTS items (id INTEGER PRIMARY KEY, qty INTEGER);
+				INSERT OR IGNORE INTO items VALUES (1, -1);`)
+			return err
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	errs := l.RebuildTable(context.Background(), TableRebuild{
+		Table:   "items",
+		Columns: "id INTEGER PRIMARY KEY, qty INTEGER CHECK (qty >= 0)",
+	})
+	if errs[1] == nil {
+		t.Fatal("expected the check constraint to fail the rebuild")
+	}
+
+	s, err := l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema string
+	if err := s.Writer.QueryRow("SELECT sql FROM sqlite_master WHERE name = 'items'").Scan(&schema); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(schema, "CHECK") {
+		t.Fatalf("expected the old table to be kept, got %s", schema)
+	}
+}
+
+func TestRebuildTableDependents(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    t.TempDir(),
+		TotalShards: 1,
+		InitSchemaFunc: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				CREATE TABLE IF NOT EXISTS items (id INTEGER PRIMARY KEY, qty TEXT);
+				CREATE TABLE IF NOT EXISTS log (item INTEGER);
+				CREATE VIEW IF NOT EXISTS stock AS SELECT id, qty FROM items WHERE qty > 0;
+				CREATE TRIGGER IF NOT EXISTS log_item AFTER INSERT ON log BEGIN
+					UPDATE items SET qty = qty - 1 WHERE id = new.item;
+				END;
+				INSERT OR IGNORE INTO items VALUES (1, '5');`)
+			return err
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	errs := l.RebuildTable(t.Context(), TableRebuild{
+		Table:   "items",
+		Columns: "id INTEGER PRIMARY KEY, qty INTEGER NOT NULL",
+	})
+	if errs[1] != nil {
+		t.Fatal(errs[1])
+	}
+
+	s, err := l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("INSERT INTO log VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	var qty int
+	if err := s.Writer.QueryRow("SELECT qty FROM stock WHERE id = 1").Scan(&qty); err != nil {
+		t.Fatalf("expected the view to be recreated: %v", err)
+	}
+	if qty != 4 {
+		t.Fatalf("expected the trigger to be recreated, got qty %d", qty)
+	}
+}
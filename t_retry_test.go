@@ -0,0 +1,62 @@
+package litebeam
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ncruces/go-sqlite3"
+)
+
+func TestRetryBusy(t *testing.T) {
+	p := RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+
+	calls := 0
+	err := p.do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return sqlite3.BUSY
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	p := RetryPolicy{Attempts: 2, Backoff: time.Millisecond}
+
+	calls := 0
+	err := p.do(context.Background(), func() error {
+		calls++
+		return sqlite3.LOCKED
+	})
+	if !errors.Is(err, sqlite3.LOCKED) {
+		t.Fatalf("expected locked error, got %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", calls)
+	}
+}
+
+func TestRetryOtherErrors(t *testing.T) {
+	p := RetryPolicy{Attempts: 5, Backoff: time.Millisecond}
+
+	calls := 0
+	want := errors.New("boom")
+	err := p.do(context.Background(), func() error {
+		calls++
+		return want
+	})
+	if err != want {
+		t.Fatalf("expected %v, got %v", want, err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected no retries, got %d calls", calls)
+	}
+}
@@ -0,0 +1,55 @@
+package litebeam
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestSeedFunc(t *testing.T) {
+	dir := t.TempDir()
+	seeds := 0
+	fail := true
+	c := Config{
+		BasePath:    dir,
+		TotalShards: 1,
+		InitSchemaFunc: func(db *sql.DB) error {
+			_, err := db.Exec("CREATE TABLE IF NOT EXISTS settings (key TEXT PRIMARY KEY, value TEXT)")
+			return err
+		},
+		SeedFunc: func(ctx context.Context, info ShardInfo, db *sql.DB) error {
+			seeds++
+			if fail {
+				return errors.New("seed failed")
+			}
+			_, err := db.ExecContext(ctx, "INSERT INTO settings VALUES ('shard', ?)", info.ID)
+			return err
+		},
+	}
+
+	if _, err := NewLitebeam(c); err == nil {
+		t.Fatal("expected seed failure")
+	}
+
+	fail = false
+	l, err := NewLitebeam(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value string
+	if err := l.Shards[1].Reader.QueryRow("SELECT value FROM settings WHERE key = 'shard'").Scan(&value); err != nil {
+		t.Fatalf("expected seeded row after retry: %v", err)
+	}
+	l.Close()
+
+	l, err = NewLitebeam(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	if seeds != 2 {
+		t.Fatalf("expected seed to run only for new shards, ran %d times", seeds)
+	}
+}
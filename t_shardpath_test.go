@@ -0,0 +1,70 @@
+package litebeam
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShardPathFunc(t *testing.T) {
+	dir := t.TempDir()
+	conf := Config{
+		BasePath:    dir,
+		TotalShards: 3,
+		ShardPathFunc: func(id int) string {
+			return fmt.Sprintf("tenants/tenant-%02d.sqlite", id)
+		},
+	}
+	l, err := NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	for id := 1; id <= 3; id++ {
+		path := filepath.Join(dir, fmt.Sprintf("tenants/tenant-%02d.sqlite", id))
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("expected shard %d at %s: %v", id, path, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "shard_1.db")); !os.IsNotExist(err) {
+		t.Fatal("expected no default-named shard files")
+	}
+
+	os.Remove(filepath.Join(dir, "tenants/tenant-02.sqlite"))
+	conf.ConsistencyPolicy = ConsistencyFail
+	if _, err := NewLitebeam(conf); err == nil {
+		t.Fatal("expected the missing shard to be reported")
+	}
+}
+
+func TestFanOutDirs(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLitebeam(Config{BasePath: dir, TotalShards: 4, FanOutDirs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	for id := 1; id <= 4; id++ {
+		name := fmt.Sprintf("shard_%d.db", id)
+		path := filepath.Join(dir, fanOutDir(name), name)
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("expected shard %d at %s: %v", id, path, err)
+		}
+	}
+
+	l, err = NewLitebeam(Config{BasePath: dir, TotalShards: 2, FanOutDirs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	orphans, err := l.FindOrphans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 2 {
+		t.Fatalf("expected shards 3 and 4 as orphans, got %v", orphans)
+	}
+}
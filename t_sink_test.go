@@ -0,0 +1,64 @@
+package litebeam
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingSink struct {
+	mu       sync.Mutex
+	counters map[string]int64
+	gauges   map[string]float64
+	timings  map[string]int
+}
+
+func newRecordingSink() *recordingSink {
+	return &recordingSink{counters: map[string]int64{}, gauges: map[string]float64{}, timings: map[string]int{}}
+}
+
+func (s *recordingSink) Counter(name string, shardID int, delta int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[name] += delta
+}
+
+func (s *recordingSink) Gauge(name string, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gauges[name] = value
+}
+
+func (s *recordingSink) Timing(name string, shardID int, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timings[name]++
+}
+
+func TestMetricsSink(t *testing.T) {
+	sink := newRecordingSink()
+	l, err := NewLitebeam(Config{BasePath: t.TempDir(), TotalShards: 3, MaxOpenShards: 2, MetricsSink: sink})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for id := 1; id <= 3; id++ {
+		if _, err := l.GetShard(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := l.AssignToShard("item"); err != nil {
+		t.Fatal(err)
+	}
+
+	if sink.counters["shard.opens"] != 3 || sink.counters["shards.created"] != 3 || sink.counters["assignments"] != 1 {
+		t.Fatalf("unexpected counters %v", sink.counters)
+	}
+	if sink.timings["shard.open"] != 3 {
+		t.Fatalf("expected 3 open timings, got %v", sink.timings)
+	}
+	if sink.gauges["shards.open"] != 2 {
+		t.Fatalf("expected 2 open shards after eviction, got %v", sink.gauges)
+	}
+}
@@ -0,0 +1,54 @@
+package litebeam
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	backups := t.TempDir()
+	l, err := NewLitebeam(Config{
+		BasePath:       t.TempDir(),
+		TotalShards:    3,
+		MaxOpenShards:  3,
+		InitSchemaFunc: itemsSchema,
+		BackupDir:      backups,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s, err := l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("INSERT INTO items (id) VALUES (1), (2)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.BackupAll(t.Context(), filepath.Join(backups, "20240101T000000Z")); err != nil {
+		t.Fatal(err)
+	}
+	l.Quarantine(3, nil)
+
+	stats, err := l.Stats(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalRows != 2 || stats.Shards[0].Rows != 2 {
+		t.Fatalf("expected 2 rows in shard 1, got %+v", stats)
+	}
+	if stats.Shards[2].Status != StatusQuarantined {
+		t.Fatalf("expected shard 3 quarantined, got %s", stats.Shards[2].Status)
+	}
+	if stats.LastBackup == nil || stats.Shards[0].LastBackup == nil || stats.Shards[0].SizeBytes == 0 {
+		t.Fatalf("expected backup times and sizes, got %+v", stats.Shards[0])
+	}
+	if v := stats.Volumes; len(v) != 1 || v[0].Path != l.Config.BasePath || v[0].Error != "" || v[0].TotalBytes == 0 || v[0].FreeBytes > v[0].TotalBytes {
+		t.Fatalf("expected the base path's volume, got %+v", v)
+	}
+	if _, err := json.Marshal(stats); err != nil {
+		t.Fatal(err)
+	}
+}
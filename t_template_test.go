@@ -0,0 +1,55 @@
+package litebeam
+
+import "testing"
+
+func TestSchemaTemplateShard(t *testing.T) {
+	dir := t.TempDir() + "/"
+	l, err := NewLitebeam(Config{
+		BasePath:    dir,
+		TotalShards: 3,
+		Migrations:  testMigrations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Shards[1].Writer.Exec("CREATE INDEX users_email ON users (email)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeDBFiles(dir + "shard_3.db"); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = NewLitebeam(Config{
+		BasePath:            dir,
+		TotalShards:         3,
+		SchemaTemplateShard: 1,
+		Migrations:          testMigrations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	want, err := l.ShardSchema(t.Context(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := l.ShardSchema(t.Context(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diffSchema(3, want, got); d != nil {
+		t.Fatalf("expected cloned schema to match template, got %+v", d)
+	}
+
+	results, err := l.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := results[2]; r.From != 2 {
+		t.Fatalf("expected cloned shard to inherit version 2, got %d", r.From)
+	}
+}
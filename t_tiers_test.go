@@ -0,0 +1,77 @@
+package litebeam
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveShardToTier(t *testing.T) {
+	hot, cold := t.TempDir(), t.TempDir()
+	conf := Config{
+		BasePath:    hot,
+		TotalShards: 2,
+		Tiers:       map[string]string{"cold": cold},
+		InitSchemaFunc: func(db *sql.DB) error {
+			_, err := db.Exec("CREATE TABLE IF NOT EXISTS items (id INTEGER PRIMARY KEY)")
+			return err
+		},
+	}
+	l, err := NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s, err := l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Writer.Exec("INSERT INTO items VALUES (42)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.MoveShardToTier(t.Context(), 1, "cold"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(hot, "shard_1.db")); !os.IsNotExist(err) {
+		t.Fatal("expected shard 1 to be removed from the hot path")
+	}
+	if _, err := os.Stat(filepath.Join(cold, "shard_1.db")); err != nil {
+		t.Fatalf("expected shard 1 in the cold tier: %v", err)
+	}
+
+	s, err = l.GetShard(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	if err := s.Reader.QueryRow("SELECT id FROM items").Scan(&id); err != nil || id != 42 {
+		t.Fatalf("expected moved row, got %d, %v", id, err)
+	}
+
+	_, release, err := l.AcquireShard(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.MoveShardToTier(t.Context(), 2, "cold"); err == nil {
+		t.Fatal("expected a leased shard not to move")
+	}
+	release()
+	if err := l.MoveShardToTier(t.Context(), 2, "warm"); err == nil {
+		t.Fatal("expected an unknown tier to fail")
+	}
+
+	// Reopening finds the shard in its tier rather than creating it again.
+	l.Close()
+	conf.ConsistencyPolicy = ConsistencyFail
+	l, err = NewLitebeam(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := os.Stat(filepath.Join(hot, "shard_1.db")); !os.IsNotExist(err) {
+		t.Fatal("expected shard 1 not to be recreated in the hot path")
+	}
+}
@@ -0,0 +1,37 @@
+package litebeam
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestWarmup(t *testing.T) {
+	l, err := NewLitebeam(Config{
+		BasePath:    t.TempDir(),
+		TotalShards: 3,
+		InitSchemaFunc: func(db *sql.DB) error {
+			_, err := db.Exec("CREATE TABLE IF NOT EXISTS users (id TEXT PRIMARY KEY)")
+			return err
+		},
+		WarmupStatements: []string{"SELECT id FROM users WHERE id = ?"},
+		WarmupBytes:      1 << 20,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if err := l.Warmup(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	for id, s := range l.Shards {
+		if s.Reader.Stats().Idle == 0 {
+			t.Fatalf("expected an idle reader connection on shard %d", id)
+		}
+	}
+
+	l.Config.WarmupStatements = []string{"SELECT nope FROM missing"}
+	if err := l.Warmup(t.Context(), 2); err == nil {
+		t.Fatal("expected bad warmup statement to fail")
+	}
+}
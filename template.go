@@ -0,0 +1,74 @@
+package litebeam
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// cloneSchema copies the schema objects of the database at templatePath,
+// encrypted with templateKey if set, into db, in creation order, along with
+// its schema_migrations rows so Migrate does not reapply them. It does
+// nothing if the template does not exist yet.
+func cloneSchema(ctx context.Context, db *sql.DB, templatePath string, templateKey []byte) error {
+	if _, err := os.Stat(templatePath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	// ATTACH is per connection, so pin one for the whole copy.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS template", sqlName(templatePath, templateKey)); err != nil {
+		return fmt.Errorf("error attaching template: %v", err)
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE template")
+
+	rows, err := conn.QueryContext(ctx, `
+		SELECT name, sql FROM template.sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+		ORDER BY rowid`)
+	if err != nil {
+		return err
+	}
+	var stmts []string
+	hasMigrations := false
+	for rows.Next() {
+		var name, stmt string
+		if err := rows.Scan(&name, &stmt); err != nil {
+			rows.Close()
+			return err
+		}
+		stmts = append(stmts, stmt)
+		if name == "schema_migrations" {
+			hasMigrations = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("error cloning %q: %v", stmt, err)
+		}
+	}
+	if hasMigrations {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO main.schema_migrations SELECT * FROM template.schema_migrations"); err != nil {
+			return fmt.Errorf("error cloning schema_migrations: %v", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,116 @@
+package litebeam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// MoveShardToTier moves shard id's file into the directory of the named
+// tier. The shard is checkpointed and closed, its file copied and checked
+// with quick_check under a temporary name, renamed into place, and only
+// then is the original removed. While the move runs, requests for the shard
+// fail with ErrShardMoving; afterwards it is reopened from its new place on
+// next use. A shard that is leased cannot be moved.
+func (l *Litebeam) MoveShardToTier(ctx context.Context, id int, tier string) error {
+	if err := l.writable(); err != nil {
+		return err
+	}
+	dir, ok := l.Config.Tiers[tier]
+	if !ok {
+		return fmt.Errorf("unknown tier %q", tier)
+	}
+	name := l.Config.shardName(id)
+	if filepath.IsAbs(name) {
+		return fmt.Errorf("shard %d has an absolute path and cannot be moved", id)
+	}
+
+	// Opening the shard first replays any WAL left behind, so closing it
+	// leaves everything in the main file.
+	done, err := l.detachShard(id, true)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	src, dst := l.Config.shardPath(id), dir+name
+	if src == dst {
+		return nil
+	}
+	key, err := shardKey(l.Config.KeyProvider, id)
+	if err != nil {
+		return err
+	}
+	if err := copyShardFile(ctx, src, dst, key); err != nil {
+		return fmt.Errorf("error moving shard %d to tier %s: %v", id, tier, err)
+	}
+	if err := removeDBFiles(src); err != nil {
+		return fmt.Errorf("error removing shard %d from its old place: %v", id, err)
+	}
+	return nil
+}
+
+// copyShardFile copies the database at src to dst through a temporary file
+// that is synced and checked, decrypting with key if set, before being
+// renamed into place.
+func copyShardFile(ctx context.Context, src, dst string, key []byte) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp := dst + ".tmp"
+	defer os.Remove(tmp)
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	if err := quickCheck(ctx, tmp, key); err != nil {
+		return err
+	}
+	// A WAL left next to dst would be replayed over the new file.
+	for _, p := range []string{dst + "-wal", dst + "-shm"} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(tmp, dst)
+}
+
+// quickCheck opens the database at path read-only, decrypting it with key
+// if set, and runs quick_check.
+func quickCheck(ctx context.Context, path string, key []byte) error {
+	db, err := openFile(path, key)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRowContext(ctx, "PRAGMA quick_check").Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("quick_check failed: %s", result)
+	}
+	return nil
+}
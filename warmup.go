@@ -0,0 +1,75 @@
+package litebeam
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+)
+
+// Warmup opens a connection on every pool of the given shards, or of all
+// shards when none are given, prepares Config.WarmupStatements on each, and
+// reads the first Config.WarmupBytes of each file so the OS page cache is
+// warm before traffic arrives. Errors from all shards are joined together.
+func (l *Litebeam) Warmup(ctx context.Context, shardIDs ...int) error {
+	if len(shardIDs) == 0 {
+		shardIDs = l.shardIDs()
+	}
+
+	results := l.fanOut(ctx, shardIDs, runtime.GOMAXPROCS(0), func(ctx context.Context, id int, s *Shard) error {
+		for _, db := range s.dbs() {
+			if err := l.warmupDB(ctx, db); err != nil {
+				return err
+			}
+		}
+		if l.Config.WarmupBytes > 0 {
+			return warmupFile(l.Config.shardPath(id), l.Config.WarmupBytes)
+		}
+		return nil
+	})
+
+	var errs []error
+	for _, id := range shardIDs {
+		if err := results[id]; err != nil {
+			errs = append(errs, fmt.Errorf("failed to warm up shard %d: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// warmupDB opens a connection on db, which loads the schema, and prepares
+// the warmup statements on it.
+func (l *Litebeam) warmupDB(ctx context.Context, db *sql.DB) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, query := range l.Config.WarmupStatements {
+		stmt, err := conn.PrepareContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		stmt.Close()
+	}
+	return nil
+}
+
+// warmupFile reads up to n bytes of path and discards them.
+func warmupFile(path string, n int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.CopyN(io.Discard, f, n)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}